@@ -1,6 +1,6 @@
 module github.com/Ullaakut/astronomer
 
-go 1.12
+go 1.13
 
 require (
 	github.com/Ullaakut/disgo v0.3.1
@@ -1,10 +1,17 @@
 package main
 
 import (
+	gocontext "context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -16,6 +23,22 @@ import (
 	"github.com/Ullaakut/disgo/style"
 )
 
+// Exit codes of astronomer, so that scripts can tell invalid arguments
+// apart from failures of the GitHub API.
+const (
+	exitFailure     = 1
+	exitUsage       = 2
+	exitAuth        = 3
+	exitNotFound    = 4
+	exitRateLimited = 5
+	exitTimeout     = 6
+	exitServerError = 7
+	exitPartialData = 8
+
+	// Conventional exit code of processes stopped by SIGINT.
+	exitInterrupted = 130
+)
+
 func parseArguments() error {
 	viper.SetEnvPrefix("astronomer")
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
@@ -23,7 +46,25 @@ func parseArguments() error {
 	pflag.BoolP("verbose", "v", false, "Show extra logs (including comparative reports)")
 	pflag.BoolP("all", "a", false, "Force astronomer to scall every stargazer of the repository (overrides --stars)")
 	pflag.UintP("stars", "s", 1000, "Maxmimum amount of stars to scan, if fast mode is enabled")
+	pflag.Uint("strata", 5, "Amount of equal-sized slices of the stargazer timeline from which random stargazers are selected")
+	pflag.Int64("seed", 0, "Seed of the random selection of stargazers, to reproduce a previous report. Random by default")
+	pflag.Uint("population", 0, "Amount of first stargazers among which to select stargazers, to reproduce a previous report along with --seed. Every stargazer by default")
+	pflag.IntP("since-year", "y", 2013, "Year since which to fetch contributions. Recent years make scans cheaper")
+	pflag.UintP("workers", "w", 4, "Maximum amount of concurrent requests when fetching contributions")
+	pflag.BoolP("resume", "r", false, "Resume the last scan of the repository with the same sample of stargazers")
+	pflag.BoolP("incremental", "i", false, "Update the last scan of the repository with the stargazers that starred it since then")
+	pflag.BoolP("partial-report", "p", false, "Compute and render a partial report from the users fetched so far if the scan is interrupted")
 	pflag.StringP("cachedir", "c", "./data", "Set the directory in which to store cache data")
+	pflag.StringP("token-file", "t", "", "Read additional GitHub tokens from a file, one per line")
+	pflag.String("app-id", "", "Authenticate as an installation of the GitHub App with this ID")
+	pflag.String("app-installation-id", "", "ID of the GitHub App installation to authenticate as")
+	pflag.String("app-private-key", "", "Path to the PEM encoded private key of the GitHub App")
+	pflag.StringP("endpoint", "e", gql.DefaultEndpoint, "Set the GitHub GraphQL API endpoint to query (for GitHub Enterprise Server instances)")
+	pflag.String("proxy", "", "URL of the proxy through which to send requests. Defaults to the HTTPS_PROXY environment variable")
+	pflag.String("ca-bundle", "", "Path to a PEM encoded bundle of certificate authorities to trust in addition to the system ones")
+	pflag.Duration("timeout", 0, "Maximum duration of each request, such as 30s. No limit by default")
+	pflag.String("user-agent-suffix", "", "Text to append to the user agent of requests")
+	pflag.Bool("dry-run", false, "Check the tokens and the repository, estimate the cost of the scan, and exit without scanning")
 
 	viper.AutomaticEnv()
 
@@ -47,7 +88,7 @@ func main() {
 	err := parseArguments()
 	if err != nil {
 		disgo.Errorln(style.Failure(style.SymbolCross, err))
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	disgo.SetTerminalOptions(disgo.WithColors(true), disgo.WithDebug(viper.GetBool("verbose")))
@@ -58,54 +99,230 @@ func main() {
 	repoInfo := strings.Split(repository, "/")
 	if len(repoInfo) != 2 {
 		disgo.Errorln(style.Failure(style.SymbolCross, " invalid repository %q: should be of the form \"repoOwner/repoName\"", repository))
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+
+	tokens, err := githubTokens(viper.GetString("token-file"))
+	if err != nil {
+		disgo.Errorln(style.Failure(style.SymbolCross, " ", err))
+		os.Exit(exitUsage)
+	}
+
+	var appPrivateKey []byte
+	if path := viper.GetString("app-private-key"); path != "" {
+		appPrivateKey, err = ioutil.ReadFile(path)
+		if err != nil {
+			disgo.Errorln(style.Failure(style.SymbolCross, " unable to read GitHub App private key: ", err))
+			os.Exit(exitUsage)
+		}
+	}
+
+	var caBundle []byte
+	if path := viper.GetString("ca-bundle"); path != "" {
+		caBundle, err = ioutil.ReadFile(path)
+		if err != nil {
+			disgo.Errorln(style.Failure(style.SymbolCross, " unable to read CA bundle: ", err))
+			os.Exit(exitUsage)
+		}
 	}
 
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		disgo.Errorln(style.Failure(style.SymbolCross, " missing github access token. Please set one in your GITHUB_TOKEN environment variable, with \"repo\" rights."))
-		os.Exit(1)
+	if len(tokens) == 0 && viper.GetString("app-id") == "" {
+		disgo.Errorln(style.Failure(style.SymbolCross, " missing github access token. Please set one in your GITHUB_TOKEN environment variable, with \"repo\" rights, or use the --app-id option to authenticate as a GitHub App."))
+		os.Exit(exitUsage)
 	}
 
 	ctx := &context.Context{
-		RepoOwner:          repoInfo[0],
-		RepoName:           repoInfo[1],
-		GithubToken:        token,
-		Stars:              viper.GetUint("stars"),
-		CacheDirectoryPath: viper.GetString("cachedir"),
-		ScanAll:            viper.GetBool("all"),
-		Verbose:            viper.GetBool("verbose"),
+		RepoOwner:               repoInfo[0],
+		RepoName:                repoInfo[1],
+		GithubTokens:            tokens,
+		GithubAppID:             viper.GetString("app-id"),
+		GithubAppInstallationID: viper.GetString("app-installation-id"),
+		GithubAppPrivateKey:     appPrivateKey,
+		Stars:                   viper.GetUint("stars"),
+		Strata:                  viper.GetUint("strata"),
+		Seed:                    viper.GetInt64("seed"),
+		Population:              viper.GetUint("population"),
+		SinceYear:               viper.GetInt("since-year"),
+		Workers:                 viper.GetUint("workers"),
+		CacheDirectoryPath:      viper.GetString("cachedir"),
+		GraphQLEndpoint:         viper.GetString("endpoint"),
+		ProxyURL:                viper.GetString("proxy"),
+		CABundle:                caBundle,
+		Timeout:                 viper.GetDuration("timeout"),
+		UserAgentSuffix:         viper.GetString("user-agent-suffix"),
+		ScanAll:                 viper.GetBool("all"),
+		Resume:                  viper.GetBool("resume"),
+		Incremental:             viper.GetBool("incremental"),
+		PartialReport:           viper.GetBool("partial-report"),
+		Verbose:                 viper.GetBool("verbose"),
+	}
+
+	// GitHub was launched in 2008, so there are no contributions before that.
+	if ctx.SinceYear < 2008 || ctx.SinceYear > time.Now().Year() {
+		disgo.Errorln(style.Failure(style.SymbolCross, " invalid year ", ctx.SinceYear, ": should be between 2008 and the current year"))
+		os.Exit(exitUsage)
 	}
 
-	if err := detectFakeStars(ctx); err != nil {
+	cancelCtx, cancel := gocontext.WithCancel(gocontext.Background())
+	defer cancel()
+
+	handleSignals(cancel)
+
+	if err := preflight(cancelCtx, ctx); err != nil {
 		disgo.Errorln(style.Failure(style.SymbolCross, " ", err))
-		os.Exit(1)
+
+		if cancelCtx.Err() != nil {
+			os.Exit(exitInterrupted)
+		}
+		os.Exit(exitCode(err))
+	}
+
+	if viper.GetBool("dry-run") {
+		return
+	}
+
+	if err := detectFakeStars(cancelCtx, ctx); err != nil {
+		disgo.Errorln(style.Failure(style.SymbolCross, " ", err))
+
+		if cancelCtx.Err() != nil {
+			os.Exit(exitInterrupted)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit code that matches the class of the
+// given error of a scan.
+func exitCode(err error) int {
+	switch gql.KindOf(err) {
+	case gql.AuthError:
+		return exitAuth
+	case gql.NotFoundError:
+		return exitNotFound
+	case gql.RateLimitedError:
+		return exitRateLimited
+	case gql.TimeoutError:
+		return exitTimeout
+	case gql.ServerError:
+		return exitServerError
+	case gql.PartialDataError:
+		return exitPartialData
+	default:
+		return exitFailure
+	}
+}
+
+// githubTokens returns the GitHub tokens to use for the scan. They are read
+// from the GITHUB_TOKEN environment variable, which can contain a comma
+// separated list of tokens, from environment variables prefixed with
+// GITHUB_TOKEN_, and from the given file, if any.
+func githubTokens(tokenFile string) ([]string, error) {
+	values := strings.Split(os.Getenv("GITHUB_TOKEN"), ",")
+
+	var prefixed []string
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, "GITHUB_TOKEN_") {
+			prefixed = append(prefixed, env)
+		}
+	}
+	sort.Strings(prefixed)
+
+	for _, env := range prefixed {
+		values = append(values, env[strings.Index(env, "=")+1:])
+	}
+
+	if tokenFile != "" {
+		data, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read token file: %v", err)
+		}
+
+		values = append(values, strings.Split(string(data), "\n")...)
+	}
+
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+
+		// Skip empty lines, comments and duplicates.
+		if value == "" || strings.HasPrefix(value, "#") || seen[value] {
+			continue
+		}
+
+		seen[value] = true
+		tokens = append(tokens, value)
+	}
+
+	return tokens, nil
+}
+
+// handleSignals cancels the scan when SIGINT or SIGTERM is received. A
+// second signal makes astronomer exit immediately.
+func handleSignals(cancel gocontext.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		disgo.Infoln(style.Important("\nInterrupted, stopping the scan. Interrupt again to exit immediately."))
+		cancel()
+
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// preflight checks the tokens and the repository before scanning it, and
+// prints an estimate of the cost of the scan.
+func preflight(cancelCtx gocontext.Context, ctx *context.Context) error {
+	checks, err := gql.RunPreflight(cancelCtx, ctx)
+	if err != nil {
+		return err
+	}
+
+	disgo.Infof("Repository %s/%s has %d stargazers\n", ctx.RepoOwner, ctx.RepoName, checks.Stargazers)
+
+	for _, token := range checks.Tokens {
+		if token.Limit == 0 {
+			disgo.Infof("%s is rate limited until %s\n", strings.Title(token.Name), token.ResetAt.Format("15:04:05"))
+		} else {
+			disgo.Infof("%s has %d/%d points remaining, restored at %s\n", strings.Title(token.Name), token.Remaining, token.Limit, token.ResetAt.Format("15:04:05"))
+		}
+
+		if scope := token.MissingScope(); scope != "" {
+			disgo.Infoln(style.Important(fmt.Sprintf("%s does not have the %q scope, so private repositories and contributions can't be read", strings.Title(token.Name), scope)))
+		}
 	}
+
+	estimate := gql.EstimateScan(ctx, checks)
+	disgo.Infof("Scanning %d stargazers with %d years of contributions takes about %d queries (%d points), %d REST requests and %d avatar downloads, in about %s, plus retries of failed requests\n",
+		estimate.Stargazers, estimate.Years, estimate.Queries, estimate.Cost, estimate.RESTRequests, estimate.AvatarDownloads, estimate.Duration.Round(time.Minute))
+
+	return nil
 }
 
-func detectFakeStars(ctx *context.Context) error {
+func detectFakeStars(cancelCtx gocontext.Context, ctx *context.Context) error {
 	disgo.Infof("Beginning fetching process for repository %s/%s\n", ctx.RepoOwner, ctx.RepoName)
 
-	cursors, totalUsers, err := gql.FetchStargazers(ctx)
+	// Errors of the GitHub API are returned as is, to exit with the code of their class.
+	stargazers, totalUsers, err := gql.FetchStargazers(cancelCtx, ctx)
 	if err != nil {
-		return fmt.Errorf("failed to query stargazer data: %s", err)
+		return err
 	}
 
 	if totalUsers < 1000 {
 		disgo.Infoln(style.Important("This repository appears to have a low amount of stargazers. Trust calculations might not be accurate."))
 	}
 
-	// For now, we only fetch contributions since 2013. It will be configurable later on
-	// once the algorithm is more accurate and more data has been fetched.
-	if !ctx.ScanAll && totalUsers > ctx.Stars {
-		disgo.Infof("Fetching contributions for %d users up to year %d\n", ctx.Stars, 2013)
-	} else {
-		disgo.Infof("Fetching contributions for %d users up to year %d\n", totalUsers, 2013)
-	}
+	disgo.Infof("Fetching contributions for %d users up to year %d\n", len(stargazers), ctx.SinceYear)
 
-	users, err := gql.FetchContributions(ctx, cursors, 2013)
+	users, dropped, err := gql.FetchContributions(cancelCtx, ctx, stargazers, ctx.SinceYear)
+	if cancelCtx.Err() != nil {
+		return interruptedScan(ctx, users, dropped)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to query stargazer data: %s", err)
+		return err
 	}
 
 	report, err := trust.Compute(ctx, users)
@@ -113,6 +330,8 @@ func detectFakeStars(ctx *context.Context) error {
 		return fmt.Errorf("unable to compute trust report: %v", err)
 	}
 
+	report.Dropped = droppedByReason(dropped)
+
 	trust.Render(report, true)
 
 	err = signature.SendReport(ctx, report)
@@ -128,3 +347,43 @@ func detectFakeStars(ctx *context.Context) error {
 
 	return nil
 }
+
+// interruptedScan handles scans that were interrupted while fetching
+// contributions. If partial reports are enabled, it computes and renders
+// a report from the users that were fetched so far. Partial reports are
+// not sent to the astronomer server.
+func interruptedScan(ctx *context.Context, users []gql.User, dropped []gql.DroppedUser) error {
+	if !ctx.PartialReport {
+		return errors.New("scan interrupted, run it again with --resume to continue where it stopped")
+	}
+
+	if len(users) == 0 {
+		return errors.New("scan interrupted before any user contributions were fetched")
+	}
+
+	report, err := trust.Compute(ctx, users)
+	if err != nil {
+		return fmt.Errorf("unable to compute partial trust report: %v", err)
+	}
+	report.Partial = true
+	report.Dropped = droppedByReason(dropped)
+
+	trust.Render(report, true)
+
+	return fmt.Errorf("scan interrupted, partial report computed from %d users. Run it again with --resume to continue where it stopped", len(users))
+}
+
+// droppedByReason returns the amount of stargazers that were dropped
+// during the scan for each reason.
+func droppedByReason(dropped []gql.DroppedUser) map[string]int {
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	reasons := make(map[string]int)
+	for _, user := range dropped {
+		reasons[user.Reason]++
+	}
+
+	return reasons
+}
@@ -1,12 +1,56 @@
 package context
 
+import (
+	"net/http"
+	"time"
+)
+
 // Context represents the context of an Astronomer scan.
 type Context struct {
 	RepoOwner          string
 	RepoName           string
-	GithubToken        string
 	CacheDirectoryPath string
 
+	// GithubTokens are the tokens used to query the GitHub API.
+	// Requests are spread between them, so that scans can use
+	// the rate limit budget of several accounts.
+	GithubTokens []string
+
+	// GithubAppID, GithubAppInstallationID and GithubAppPrivateKey
+	// authenticate requests as an installation of a GitHub App, with
+	// short-lived tokens that are refreshed before they expire. The
+	// private key is PEM encoded.
+	GithubAppID             string
+	GithubAppInstallationID string
+	GithubAppPrivateKey     []byte
+
+	// GraphQLEndpoint is the URL of the GitHub GraphQL API to
+	// query. It can point to a GitHub Enterprise Server instance.
+	GraphQLEndpoint string
+
+	// RESTEndpoint is the base URL of the GitHub REST API. When
+	// empty, it is derived from the GraphQL endpoint.
+	RESTEndpoint string
+
+	// ProxyURL is the URL of the proxy through which requests are
+	// sent. When empty, the proxy set in the environment is used.
+	ProxyURL string
+
+	// CABundle contains PEM encoded certificates of the certificate
+	// authorities to trust in addition to the system ones.
+	CABundle []byte
+
+	// Timeout limits the time that each request can take, including
+	// reading its response. Zero means no timeout.
+	Timeout time.Duration
+
+	// UserAgentSuffix is appended to the user agent of requests.
+	UserAgentSuffix string
+
+	// Transport, when set, sends every request of astronomer instead
+	// of a transport built from the network settings above.
+	Transport http.RoundTripper
+
 	// ScanAll makes astronomer scan every stargazer
 	// when set to true.
 	ScanAll bool
@@ -14,6 +58,43 @@ type Context struct {
 	// Amount of stars to scan in fastMode.
 	Stars uint
 
+	// Seed is the seed of the random selection of stargazers. When
+	// zero, a random seed is used, and it is set to that seed once
+	// stargazers are selected.
+	Seed int64
+
+	// Population is the amount of first stargazers among which
+	// stargazers are selected, so that the same seed selects the same
+	// stargazers after the repository received new stars. When zero,
+	// every stargazer is part of it, and it is set to their amount once
+	// stargazers are selected.
+	Population uint
+
+	// Strata is the amount of equal-sized slices of the stargazer
+	// timeline from which the same amount of random stargazers are
+	// selected.
+	Strata uint
+
+	// SinceYear is the year since which contributions
+	// are fetched.
+	SinceYear int
+
+	// Workers is the amount of contribution pages that
+	// are fetched concurrently.
+	Workers uint
+
+	// Resume makes astronomer resume the last scan of the
+	// repository, with the same sample of stargazers.
+	Resume bool
+
+	// Incremental makes astronomer update the last scan of the
+	// repository with the stargazers that starred it since then.
+	Incremental bool
+
+	// PartialReport makes astronomer compute a partial report from
+	// the users fetched so far when a scan is interrupted.
+	PartialReport bool
+
 	// Verbose enables the verbose mode.
 	Verbose bool
 }
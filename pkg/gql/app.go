@@ -0,0 +1,209 @@
+package gql
+
+import (
+	gocontext "context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+const (
+	// GitHub rejects app JWTs that are valid for more than ten minutes.
+	appJWTLifetime = 9 * time.Minute
+
+	// Installation tokens are refreshed when they are about to expire,
+	// so that long scans never send requests with an expired token.
+	installationTokenRefreshMargin = 5 * time.Minute
+)
+
+// appInstallation authenticates requests as an installation of a GitHub App.
+// It exchanges JWTs signed with the private key of the app for installation
+// tokens, which are valid for an hour.
+type appInstallation struct {
+	mu sync.Mutex
+
+	httpClient     *http.Client
+	endpoint       string
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+
+	token     string
+	expiresAt time.Time
+}
+
+// newAppInstallation creates an app installation from the GitHub App
+// credentials of the given context. It returns nil if none are set.
+func newAppInstallation(ctx *context.Context, httpClient *http.Client) (*appInstallation, error) {
+	if ctx.GithubAppID == "" && ctx.GithubAppInstallationID == "" && len(ctx.GithubAppPrivateKey) == 0 {
+		return nil, nil
+	}
+
+	if ctx.GithubAppID == "" || ctx.GithubAppInstallationID == "" || len(ctx.GithubAppPrivateKey) == 0 {
+		return nil, errors.New("GitHub App authentication requires an app ID, an installation ID and a private key")
+	}
+
+	key, err := parsePrivateKey(ctx.GithubAppPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appInstallation{
+		httpClient:     httpClient,
+		endpoint:       restEndpoint(ctx),
+		appID:          ctx.GithubAppID,
+		installationID: ctx.GithubAppInstallationID,
+		key:            key,
+	}, nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA private key, as generated by
+// GitHub for apps, or converted to the PKCS #8 format.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid GitHub App private key: no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %v", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid GitHub App private key: not an RSA key")
+	}
+
+	return key, nil
+}
+
+// accessToken returns a valid installation token, and creates a new one
+// if the current one is about to expire.
+func (a *appInstallation) accessToken(cancelCtx gocontext.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.expiresAt) > installationTokenRefreshMargin {
+		return a.token, nil
+	}
+
+	if err := a.refresh(cancelCtx); err != nil {
+		return "", wrapError(err, fmt.Errorf("unable to create GitHub App installation token: %v", err))
+	}
+
+	return a.token, nil
+}
+
+// refresh exchanges a new JWT for an installation token.
+func (a *appInstallation) refresh(cancelCtx gocontext.Context) error {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", a.endpoint, a.installationID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwt))
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := a.httpClient.Do(req.WithContext(cancelCtx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read response body: %v", err)
+	}
+
+	if apiErr := statusError(resp.StatusCode, body); apiErr != nil {
+		// An unknown installation means that the app credentials are wrong.
+		if apiErr.Kind == NotFoundError {
+			apiErr.Kind = AuthError
+		}
+		return apiErr
+	}
+
+	var response struct {
+		Token     string `json:"token"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("unable to unmarshal response (status %d): %v", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, response.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("unexpected expiration date %q: %v", response.ExpiresAt, err)
+	}
+
+	a.token, a.expiresAt = response.Token, expiresAt
+
+	return nil
+}
+
+// jwt returns a JSON Web Token that authenticates as the app, signed
+// with its private key using RS256.
+func (a *appInstallation) jwt(now time.Time) (string, error) {
+	// App IDs are numbers, but GitHub also accepts client IDs.
+	var issuer interface{} = a.appID
+	if id, err := strconv.ParseInt(a.appID, 10, 64); err == nil {
+		issuer = id
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The issue date is set in the past to allow for clock drift.
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": issuer,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign JWT: %v", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,289 @@
+package gql
+
+import (
+	gocontext "context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		data []byte
+
+		expectedErr bool
+	}{
+		"pkcs1 key": {
+			data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		},
+		"pkcs8 key": {
+			data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		"not an rsa key": {
+			data:        pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8}),
+			expectedErr: true,
+		},
+		"invalid key": {
+			data:        pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("invalid")}),
+			expectedErr: true,
+		},
+		"not pem encoded": {
+			data:        []byte("invalid"),
+			expectedErr: true,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			key, err := parsePrivateKey(test.data)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, rsaKey.N, key.N)
+		})
+	}
+}
+
+func TestNewAppInstallation(t *testing.T) {
+	key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testAppKey(t))})
+
+	tests := map[string]struct {
+		ctx *context.Context
+
+		expectedApp bool
+		expectedErr bool
+	}{
+		"no app": {
+			ctx: &context.Context{},
+		},
+		"app": {
+			ctx: &context.Context{
+				GithubAppID:             "1234",
+				GithubAppInstallationID: "42",
+				GithubAppPrivateKey:     key,
+			},
+			expectedApp: true,
+		},
+		"missing installation": {
+			ctx: &context.Context{
+				GithubAppID:         "1234",
+				GithubAppPrivateKey: key,
+			},
+			expectedErr: true,
+		},
+		"missing private key": {
+			ctx: &context.Context{
+				GithubAppID:             "1234",
+				GithubAppInstallationID: "42",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			app, err := newAppInstallation(test.ctx, &http.Client{})
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedApp, app != nil)
+		})
+	}
+}
+
+func TestAppInstallationRefresh(t *testing.T) {
+	key := testAppKey(t)
+
+	var (
+		requests  int32
+		expiresIn = time.Hour
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/app/installations/42/access_tokens", r.URL.Path)
+
+		claims := verifyJWT(t, &key.PublicKey, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		assert.Equal(t, float64(1234), claims["iss"])
+		assert.True(t, claims["exp"].(float64)-claims["iat"].(float64) <= 600)
+
+		count := atomic.AddInt32(&requests, 1)
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"installation-%d","expires_at":%q}`, count, time.Now().Add(expiresIn).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	app := &appInstallation{
+		httpClient:     &http.Client{},
+		endpoint:       server.URL,
+		appID:          "1234",
+		installationID: "42",
+		key:            key,
+	}
+
+	token, err := app.accessToken(gocontext.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "installation-1", token)
+
+	// The token is reused until it is about to expire.
+	token, err = app.accessToken(gocontext.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "installation-1", token)
+
+	app.expiresAt = time.Now().Add(installationTokenRefreshMargin - time.Second)
+
+	token, err = app.accessToken(gocontext.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "installation-2", token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestAppInstallationRefreshFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"A JSON web token could not be decoded"}`)
+	}))
+	defer server.Close()
+
+	app := &appInstallation{
+		httpClient:     &http.Client{},
+		endpoint:       server.URL,
+		appID:          "1234",
+		installationID: "42",
+		key:            testAppKey(t),
+	}
+
+	_, err := app.accessToken(gocontext.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "A JSON web token could not be decoded")
+	assert.Equal(t, AuthError, KindOf(err))
+}
+
+func TestQueryWithGithubApp(t *testing.T) {
+	key := testAppKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"installation","expires_at":%q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer installation", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"data":{}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := newClient(&context.Context{
+		GraphQLEndpoint:         server.URL + "/graphql",
+		RESTEndpoint:            server.URL,
+		GithubAppID:             "1234",
+		GithubAppInstallationID: "42",
+		GithubAppPrivateKey:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	})
+	require.NoError(t, err)
+
+	req, err := c.newRequest(fetchUsersQuery, nil)
+	require.NoError(t, err)
+
+	_, _, err = c.query(gocontext.Background(), req)
+	require.NoError(t, err)
+}
+
+func TestRestEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		ctx *context.Context
+
+		expectedEndpoint string
+	}{
+		"public api": {
+			ctx:              &context.Context{},
+			expectedEndpoint: "https://api.github.com",
+		},
+		"enterprise server": {
+			ctx:              &context.Context{GraphQLEndpoint: "https://github.example.com/api/graphql"},
+			expectedEndpoint: "https://github.example.com/api/v3",
+		},
+		"configured endpoint": {
+			ctx: &context.Context{
+				GraphQLEndpoint: "https://github.example.com/api/graphql",
+				RESTEndpoint:    "https://rest.example.com",
+			},
+			expectedEndpoint: "https://rest.example.com",
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedEndpoint, restEndpoint(test.ctx))
+		})
+	}
+}
+
+func testAppKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	return key
+}
+
+// verifyJWT verifies the RS256 signature of a JWT, and returns its claims.
+func verifyJWT(t *testing.T, key *rsa.PublicKey, jwt string) map[string]interface{} {
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"alg":"RS256","typ":"JWT"}`, string(header))
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature))
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+
+	return claims
+}
@@ -0,0 +1,183 @@
+package gql
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/Ullaakut/disgo"
+)
+
+// avatarsFilename is the name of the file in which the avatars that were
+// already checked are stored, at the root of the cache directory.
+const avatarsFilename = "avatars.json"
+
+// identiconBackground is the background color of the identicons that
+// GitHub generates for users who did not upload an avatar.
+var identiconBackground = color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+// avatarCache remembers which avatars are default identicons, so that
+// each avatar is only downloaded once. It is shared by every repository
+// of the cache directory, since avatar URLs change when users update
+// their avatar.
+type avatarCache struct {
+	mu sync.Mutex
+
+	Identicons map[string]bool `json:"identicons"`
+}
+
+// avatarCachePath returns the path of the avatar cache of the cache directory.
+func avatarCachePath(ctx *context.Context) string {
+	return filepath.Join(ctx.CacheDirectoryPath, avatarsFilename)
+}
+
+// loadAvatarCache loads the avatar cache of the cache directory. It returns
+// an empty cache if none was found.
+func loadAvatarCache(ctx *context.Context) (*avatarCache, error) {
+	cache := &avatarCache{
+		Identicons: make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(avatarCachePath(ctx))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("unable to read avatar cache: %v", err)
+	}
+
+	err = json.Unmarshal(data, cache)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse avatar cache: %v", err)
+	}
+
+	return cache, nil
+}
+
+// setDefaultAvatars sets whether or not each of the given users kept the
+// default identicon as their avatar, and saves the avatars that were
+// checked in the cache directory. Avatars that can't be downloaded are
+// considered to be custom ones.
+func (c *avatarCache) setDefaultAvatars(cancelCtx gocontext.Context, ctx *context.Context, httpClient *http.Client, users []User) error {
+	var checked bool
+	for idx := range users {
+		if users[idx].AvatarURL == "" {
+			continue
+		}
+
+		c.mu.Lock()
+		identicon, ok := c.Identicons[users[idx].AvatarURL]
+		c.mu.Unlock()
+
+		if !ok {
+			var err error
+			identicon, err = isIdenticonURL(cancelCtx, httpClient, users[idx].AvatarURL)
+			if cancelCtx.Err() != nil {
+				return cancelCtx.Err()
+			}
+			if err != nil {
+				disgo.Debugf("Unable to check avatar of %s: %v\n", users[idx].Login, err)
+				continue
+			}
+
+			c.mu.Lock()
+			c.Identicons[users[idx].AvatarURL] = identicon
+			c.mu.Unlock()
+
+			checked = true
+		}
+
+		users[idx].HasDefaultAvatar = identicon
+	}
+
+	if !checked {
+		return nil
+	}
+
+	return c.save(ctx)
+}
+
+// save writes the avatar cache in the cache directory.
+func (c *avatarCache) save(ctx *context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("unable to marshal avatar cache: %v", err)
+	}
+
+	err = writeFileAtomic(avatarCachePath(ctx), data)
+	if err != nil {
+		return fmt.Errorf("unable to write avatar cache: %v", err)
+	}
+
+	return nil
+}
+
+// isIdenticonURL downloads an avatar and returns whether or not it is
+// a default identicon. Identicons are always served as PNG images.
+func isIdenticonURL(cancelCtx gocontext.Context, httpClient *http.Client, url string) (bool, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := httpClient.Do(req.WithContext(cancelCtx))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/png") {
+		return false, nil
+	}
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("unable to decode avatar: %v", err)
+	}
+
+	return isIdenticon(img), nil
+}
+
+// isIdenticon returns whether or not an image is an identicon, which is
+// made of a single color pattern drawn on a light gray background.
+func isIdenticon(img image.Image) bool {
+	var (
+		background bool
+		foreground color.Color
+	)
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.RGBAModel.Convert(img.At(x, y))
+
+			switch {
+			case pixel == identiconBackground:
+				background = true
+			case foreground == nil:
+				foreground = pixel
+			case pixel != foreground:
+				return false
+			}
+		}
+	}
+
+	return background && foreground != nil
+}
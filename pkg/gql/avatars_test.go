@@ -0,0 +1,136 @@
+package gql
+
+import (
+	gocontext "context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsIdenticon(t *testing.T) {
+	tests := map[string]struct {
+		img image.Image
+
+		expectedIdenticon bool
+	}{
+		"identicon": {
+			img:               fakeAvatar(true),
+			expectedIdenticon: true,
+		},
+		"custom avatar": {
+			img: fakeAvatar(false),
+		},
+		"blank image": {
+			img: image.NewRGBA(image.Rect(0, 0, 10, 10)),
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedIdenticon, isIdenticon(test.img))
+		})
+	}
+}
+
+func TestSetDefaultAvatars(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch r.URL.Path {
+		case "/identicon":
+			w.Header().Set("Content-Type", "image/png")
+			require.NoError(t, png.Encode(w, fakeAvatar(true)))
+		case "/picture":
+			w.Header().Set("Content-Type", "image/jpeg")
+			require.NoError(t, jpeg.Encode(w, fakeAvatar(false), nil))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		CacheDirectoryPath: cacheDir,
+	}
+
+	users := []User{
+		{Login: "identicon", AvatarURL: server.URL + "/identicon"},
+		{Login: "picture", AvatarURL: server.URL + "/picture"},
+		{Login: "missing", AvatarURL: server.URL + "/missing"},
+		{Login: "none"},
+	}
+
+	avatars, err := loadAvatarCache(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, avatars.setDefaultAvatars(gocontext.Background(), ctx, &http.Client{Timeout: time.Second}, users))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	assert.True(t, users[0].HasDefaultAvatar)
+	assert.False(t, users[1].HasDefaultAvatar)
+	assert.False(t, users[2].HasDefaultAvatar)
+	assert.False(t, users[3].HasDefaultAvatar)
+
+	// Checked avatars are not downloaded again, but avatars
+	// that could not be downloaded are.
+	avatars, err = loadAvatarCache(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		server.URL + "/identicon": true,
+		server.URL + "/picture":   false,
+	}, avatars.Identicons)
+
+	users[0].HasDefaultAvatar = false
+	require.NoError(t, avatars.setDefaultAvatars(gocontext.Background(), ctx, &http.Client{Timeout: time.Second}, users))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+	assert.True(t, users[0].HasDefaultAvatar)
+}
+
+func TestFetchContributionsProfiles(t *testing.T) {
+	server := fakeStargazers(t, 4, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              20,
+		Workers:            1,
+	}
+
+	users, _, err := FetchContributions(gocontext.Background(), ctx, fakeSample(4), time.Now().Year())
+	require.NoError(t, err)
+	require.Len(t, users, 4)
+
+	for idx, user := range users {
+		assert.Equal(t, "Hi", user.Bio)
+		assert.Equal(t, 3, user.Followers.TotalCount)
+		assert.Equal(t, 4, user.Following.TotalCount)
+		assert.Equal(t, 5, user.Repositories.TotalCount)
+		assert.Equal(t, 6, user.StarredRepositories.TotalCount)
+		assert.Equal(t, idx%2 == 0, user.HasDefaultAvatar)
+	}
+}
@@ -2,6 +2,7 @@ package gql
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -51,13 +52,7 @@ func readCachedResponse(filename string, req *http.Request) (*http.Response, err
 // putCache puts the supplied http.Response into the cache.
 func putCache(ctx *context.Context, req *http.Request, pagination string, body []byte) error {
 	filename := cacheEntryFilename(ctx, req.URL.String()+pagination)
-	f, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("unable to create cache file: %v", err)
-	}
-	defer f.Close()
-
-	_, err = f.Write(body)
+	err := writeFileAtomic(filename, body)
 	if err != nil {
 		return fmt.Errorf("unable to write response in cache file: %v", err)
 	}
@@ -70,10 +65,31 @@ func putCache(ctx *context.Context, req *http.Request, pagination string, body [
 	return nil
 }
 
+// writeFileAtomic writes data to the given file, creating its directory if
+// needed. The data is written in a temporary file first, so that an
+// interrupted scan can't leave a truncated file behind.
+func writeFileAtomic(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModeDir|0755); err != nil {
+		return err
+	}
+
+	err := ioutil.WriteFile(filename+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
 // cacheEntryFilename creates a filename-safe name in a subdirectory
-// of the configured cache dir, with any access token stripped out.
+// of the configured cache dir, with any access token stripped out, so
+// that cache entries don't depend on the token used to fetch them.
 func cacheEntryFilename(ctx *context.Context, url string) string {
-	newURL := strings.Replace(url, fmt.Sprintf("access_token=%s", ctx.GithubToken), "", 1)
+	newURL := url
+	for _, token := range ctx.GithubTokens {
+		newURL = strings.Replace(newURL, fmt.Sprintf("access_token=%s", token), "", 1)
+	}
+
 	return filepath.Join(ctx.CacheDirectoryPath, ctx.RepoOwner, ctx.RepoName, sanitize.BaseName(newURL))
 }
 
@@ -87,12 +103,38 @@ func listFilePagination(cursor string) string {
 	return fmt.Sprintf("-list-%s", cursor)
 }
 
+// restFilePagination generates the pagination to append to the cache file names
+// for the pages of stargazers listed by the REST API.
+func restFilePagination(page int) string {
+	return fmt.Sprintf("-rest-%d", page)
+}
+
+// planFilePagination generates the pagination to append to the cache file names
+// for the profiles of a page of stargazers, which are used to plan contribution
+// queries. Pages are identified by the hash of the IDs of their stargazers.
+func planFilePagination(key string) string {
+	return fmt.Sprintf("-profiles-%s", key)
+}
+
 // contribFilePagination generates the pagination to append to the cache file names
-// for user contribution data.
-func contribFilePagination(cursor string, year int) string {
-	if cursor == "" {
-		return fmt.Sprintf("-firstpage-%d", year)
+// for user contribution data, which is fetched for a batch of users during a range
+// of years. The IDs of the users are hashed to keep file names short.
+func contribFilePagination(ids []string, years []int) string {
+	return fmt.Sprintf("-contrib-%s-%d-%d", hashIDs(ids), years[0], years[len(years)-1])
+}
+
+// retryFilePagination appends the attempt to the pagination of the cache file
+// names for retried requests, so that each attempt to fetch the data that
+// could not be resolved in a partial response is cached separately.
+func retryFilePagination(pagination string, retries int) string {
+	if retries == 0 {
+		return pagination
 	}
 
-	return fmt.Sprintf("-%s-%d", cursor, year)
+	return fmt.Sprintf("%s-retry%d", pagination, retries)
+}
+
+// hashIDs returns a short hash that identifies a list of node IDs.
+func hashIDs(ids []string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(ids, ","))))
 }
@@ -1,9 +1,13 @@
 package gql
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/Ullaakut/astronomer/pkg/context"
 )
 
@@ -11,7 +15,7 @@ func TestCacheEntryFilename(t *testing.T) {
 	ctx := &context.Context{
 		RepoOwner:          "ullaakut",
 		RepoName:           "astronomer",
-		GithubToken:        "fakeToken",
+		GithubTokens:       []string{"fakeToken"},
 		CacheDirectoryPath: "./data",
 	}
 
@@ -19,3 +23,22 @@ func TestCacheEntryFilename(t *testing.T) {
 
 	assert.Equal(t, "data/ullaakut/astronomer/https-fakeapi-com-graphql-1-2019", sanitizedFilename)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	filename := filepath.Join(cacheDir, "ullaakut", "astronomer", "plan.json")
+
+	require.NoError(t, writeFileAtomic(filename, []byte("first")))
+	require.NoError(t, writeFileAtomic(filename, []byte("second")))
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// No temporary file is left behind.
+	_, err = os.Stat(filename + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,373 @@
+package gql
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/Ullaakut/astronomer/pkg/httpclient"
+	"github.com/cenkalti/backoff/v3"
+)
+
+const (
+	// DefaultEndpoint is the GraphQL endpoint of the public GitHub API.
+	DefaultEndpoint = "https://api.github.com/graphql"
+
+	// DefaultRESTEndpoint is the base URL of the public GitHub REST API.
+	DefaultRESTEndpoint = "https://api.github.com"
+
+	// Maximum amount of attempts to send a query.
+	maxAttempts = 20
+
+	// Amount of consecutive timeouts after which a query that can be split
+	// in lighter queries is abandoned, since the GitHub API is unlikely to
+	// ever answer it.
+	maxTimeouts = 3
+)
+
+// errTimeout is returned when the GitHub API keeps timing out while
+// resolving a query.
+var errTimeout = &APIError{Kind: TimeoutError, Message: "GitHub API keeps timing out"}
+
+// retryInterval is the time to wait between two attempts to send a query.
+var retryInterval = 15 * time.Second
+
+// graphQLRequest is the payload of a request to a GraphQL API.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// client sends GraphQL queries and REST requests to the GitHub API.
+type client struct {
+	httpClient   *http.Client
+	endpoint     string
+	restEndpoint string
+	tokens       *tokenPool
+}
+
+// newClient creates a GraphQL client for the given context.
+func newClient(ctx *context.Context) (*client, error) {
+	httpClient, err := httpclient.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := newAppInstallation(ctx, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		httpClient:   httpClient,
+		endpoint:     endpoint(ctx),
+		restEndpoint: restEndpoint(ctx),
+		tokens:       newTokenPool(ctx.GithubTokens, app),
+	}, nil
+}
+
+// newRequest builds the HTTP request to send a query along with its variables.
+func (c *client) newRequest(query string, variables map[string]interface{}) (*http.Request, error) {
+	body, err := json.Marshal(graphQLRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal query: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// newRESTRequest builds the HTTP request to get a resource of the REST API,
+// at the given path. Stargazers are listed along with their star dates.
+func (c *client) newRESTRequest(path string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", c.restEndpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github.v3.star+json")
+
+	return req, nil
+}
+
+// do sends a request built by newRequest or newRESTRequest. It can be called
+// multiple times with the same request, for example when retrying. The request
+// is aborted if the given context is cancelled.
+func (c *client) do(cancelCtx gocontext.Context, req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read request body: %v", err)
+		}
+		req.Body = body
+	}
+
+	return c.httpClient.Do(req.WithContext(cancelCtx))
+}
+
+// query sends a request built by newRequest until the GitHub API answers it
+// successfully, and parses its response. Each attempt is authorized with the
+// token of the pool that has the most remaining budget, and waits for it to
+// be available. Whether or not a failed attempt is retried depends on the
+// class of its error. Partial responses are not retried, and are returned
+// along with a partial data error, so that only the data that could not be
+// resolved is fetched again. The body of the last response is always
+// returned, to help debugging failures.
+func (c *client) query(cancelCtx gocontext.Context, req *http.Request) (*listStargazersResponse, []byte, error) {
+	return c.send(cancelCtx, req, false)
+}
+
+// querySplittable sends a request like query does, but returns errTimeout
+// as soon as the GitHub API timed out too many times in a row, so that the
+// caller can split the request in lighter ones instead of retrying it.
+func (c *client) querySplittable(cancelCtx gocontext.Context, req *http.Request) (*listStargazersResponse, []byte, error) {
+	return c.send(cancelCtx, req, true)
+}
+
+// send implements query and querySplittable.
+func (c *client) send(cancelCtx gocontext.Context, req *http.Request, splittable bool) (*listStargazersResponse, []byte, error) {
+	var (
+		response     *listStargazersResponse
+		responseBody []byte
+		attempts     int
+		timeouts     int
+	)
+
+	err := backoff.Retry(func() error {
+		attempts++
+
+		// If rate limit was reached for every token, wait before making a request.
+		token, err := c.tokens.acquire(cancelCtx)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		credentials, err := token.credentials(cancelCtx)
+		if err != nil {
+			return giveUpAfter(attempts, err)
+		}
+
+		// Inject GitHub token for API authorization.
+		if credentials != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credentials))
+		}
+
+		resp, err := c.do(cancelCtx, req)
+		if err != nil {
+			return giveUpAfter(attempts, fmt.Errorf("unable to send request: %v", err))
+		}
+
+		// The next attempt uses another token, or waits for this one.
+		if wait, limited := secondaryRateLimit(resp); limited {
+			resp.Body.Close()
+			c.tokens.pause(token, wait)
+			return giveUpAfter(attempts, errRateLimited(resp.StatusCode))
+		}
+
+		response, responseBody, err = parseResponse(resp)
+
+		// GraphQL queries that exceed the budget of their token are answered
+		// successfully, with a RATE_LIMITED error. The next attempt uses
+		// another token, or waits for this one to be restored.
+		if KindOf(err) == RateLimitedError {
+			wait, exhausted := primaryRateLimit(resp.Header)
+			if !exhausted {
+				wait = defaultSecondaryLimitWait
+			}
+
+			c.tokens.pause(token, wait)
+			return giveUpAfter(attempts, err)
+		}
+
+		if KindOf(err) == PartialDataError {
+			c.tokens.update(token, response.RateLimit)
+			return backoff.Permanent(err)
+		}
+
+		if err != nil {
+			if KindOf(err) != TimeoutError || !splittable {
+				timeouts = 0
+				return giveUpAfter(attempts, err)
+			}
+
+			timeouts++
+			if timeouts >= maxTimeouts {
+				return backoff.Permanent(errTimeout)
+			}
+			return err
+		}
+
+		// If we approach the rate limit of the token, pause its requests until it resets.
+		c.tokens.update(token, response.RateLimit)
+
+		return nil
+	}, backoff.WithContext(backoff.NewConstantBackOff(retryInterval), cancelCtx))
+	if err != nil && KindOf(err) != PartialDataError {
+		return nil, responseBody, err
+	}
+
+	return response, responseBody, err
+}
+
+// get sends a request built by newRESTRequest until the GitHub API answers
+// it successfully, and returns the body of its response. Like queries, each
+// attempt is authorized with the token of the pool that has the most
+// remaining budget, and failed attempts are retried depending on the class
+// of their error.
+func (c *client) get(cancelCtx gocontext.Context, req *http.Request) ([]byte, error) {
+	var (
+		responseBody []byte
+		attempts     int
+	)
+
+	err := backoff.Retry(func() error {
+		attempts++
+
+		token, err := c.tokens.acquire(cancelCtx)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		credentials, err := token.credentials(cancelCtx)
+		if err != nil {
+			return giveUpAfter(attempts, err)
+		}
+
+		if credentials != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credentials))
+		}
+
+		resp, err := c.do(cancelCtx, req)
+		if err != nil {
+			return giveUpAfter(attempts, fmt.Errorf("unable to send request: %v", err))
+		}
+		defer resp.Body.Close()
+
+		if wait, limited := secondaryRateLimit(resp); limited {
+			c.tokens.pause(token, wait)
+			return giveUpAfter(attempts, errRateLimited(resp.StatusCode))
+		}
+
+		responseBody, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return giveUpAfter(attempts, fmt.Errorf("unable to read response body: %v", err))
+		}
+
+		if apiErr := statusError(resp.StatusCode, responseBody); apiErr != nil {
+			return giveUpAfter(attempts, apiErr)
+		}
+
+		return nil
+	}, backoff.WithContext(backoff.NewConstantBackOff(retryInterval), cancelCtx))
+	if err != nil {
+		return nil, err
+	}
+
+	return responseBody, nil
+}
+
+// giveUpAfter makes the retry of a query stop with the given error if
+// it is not worth retrying, or once the maximum amount of attempts is
+// reached.
+func giveUpAfter(attempts int, err error) error {
+	if !retryable(err) {
+		return backoff.Permanent(err)
+	}
+
+	if attempts >= maxAttempts {
+		return backoff.Permanent(wrapError(err, fmt.Errorf("too many failed attempts: %v", err)))
+	}
+
+	return err
+}
+
+// errRateLimited returns the error of a response that exceeded the
+// rate limit of its token.
+func errRateLimited(statusCode int) error {
+	return &APIError{
+		Kind:       RateLimitedError,
+		StatusCode: statusCode,
+		Message:    "rate limit exceeded",
+	}
+}
+
+// endpoint returns the GraphQL endpoint to query for the given context,
+// falling back to the public GitHub API if none was configured.
+func endpoint(ctx *context.Context) string {
+	if ctx.GraphQLEndpoint == "" {
+		return DefaultEndpoint
+	}
+
+	return ctx.GraphQLEndpoint
+}
+
+// restEndpoint returns the base URL of the REST API to query for the given
+// context. Unless one was configured, it is the one that matches the GraphQL
+// endpoint, since GitHub Enterprise Server instances serve it under /api/v3.
+func restEndpoint(ctx *context.Context) string {
+	if ctx.RESTEndpoint != "" {
+		return ctx.RESTEndpoint
+	}
+
+	if endpoint(ctx) == DefaultEndpoint {
+		return DefaultRESTEndpoint
+	}
+
+	return strings.TrimSuffix(endpoint(ctx), "/graphql") + "/v3"
+}
+
+// listStargazersVariables returns the variables of a query that lists
+// a page of stargazers of the scanned repository, after the given cursor.
+func listStargazersVariables(ctx *context.Context, pagination int, cursor string) map[string]interface{} {
+	variables := map[string]interface{}{
+		"repoOwner":  ctx.RepoOwner,
+		"repoName":   ctx.RepoName,
+		"pagination": pagination,
+	}
+
+	// The first page does not have any cursor to start after.
+	if cursor != "" && cursor != "firstpage" {
+		variables["cursor"] = cursor
+	}
+
+	return variables
+}
+
+// usersVariables returns the variables of a query that fetches
+// a batch of users by node ID.
+func usersVariables(ids []string) map[string]interface{} {
+	return map[string]interface{}{
+		"ids": ids,
+	}
+}
+
+// contributionsVariables returns the variables of a query that fetches the
+// contributions of the users with the given IDs during each of the given years.
+func contributionsVariables(ids []string, years []int) map[string]interface{} {
+	variables := usersVariables(ids)
+
+	for _, contributionYear := range years {
+		from := time.Date(contributionYear, time.January, 1, 0, 0, 0, 0, time.UTC)
+		to := from.Add(year - 1*time.Second)
+
+		variables[fmt.Sprintf("from%d", contributionYear)] = from.Format(iso8601Format)
+		variables[fmt.Sprintf("to%d", contributionYear)] = to.Format(iso8601Format)
+	}
+
+	return variables
+}
@@ -0,0 +1,106 @@
+package gql
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestNewRequest(t *testing.T) {
+	tests := map[string]struct {
+		query     string
+		variables map[string]interface{}
+
+		expectedVariables map[string]interface{}
+	}{
+		"list stargazers": {
+			query: fetchUsersQuery,
+			variables: listStargazersVariables(&context.Context{
+				RepoOwner: "ullaakut",
+				RepoName:  "cameradar",
+			}, 42, ""),
+
+			expectedVariables: map[string]interface{}{
+				"repoOwner":  "ullaakut",
+				"repoName":   "cameradar",
+				"pagination": float64(42),
+			},
+		},
+		"list stargazers after cursor": {
+			query: fetchUsersQuery,
+			variables: listStargazersVariables(&context.Context{
+				RepoOwner: "ullaakut",
+				RepoName:  "cameradar",
+			}, 42, "Y3Vyc29yOnYyOpIAzgNQI9s="),
+
+			expectedVariables: map[string]interface{}{
+				"repoOwner":  "ullaakut",
+				"repoName":   "cameradar",
+				"pagination": float64(42),
+				"cursor":     "Y3Vyc29yOnYyOpIAzgNQI9s=",
+			},
+		},
+		"plan contributions with special characters": {
+			query: planContributionsQuery,
+			variables: listStargazersVariables(&context.Context{
+				RepoOwner: `ullaakut"}`,
+				RepoName:  "came\\rattack\n",
+			}, contribPagination, `"cursor"`),
+
+			expectedVariables: map[string]interface{}{
+				"repoOwner":  `ullaakut"}`,
+				"repoName":   "came\\rattack\n",
+				"pagination": float64(contribPagination),
+				"cursor":     `"cursor"`,
+			},
+		},
+		"fetch contributions during a leap year": {
+			query:     contributionsQuery([]int{2016}),
+			variables: contributionsVariables([]string{"MDQ6VXNlcjE="}, []int{2016}),
+
+			expectedVariables: map[string]interface{}{
+				"ids":      []interface{}{"MDQ6VXNlcjE="},
+				"from2016": "2016-01-01T00:00:00Z",
+				"to2016":   "2016-12-30T23:59:59Z",
+			},
+		},
+		"fetch contributions for several years": {
+			query:     contributionsQuery([]int{2019, 2018}),
+			variables: contributionsVariables([]string{"MDQ6VXNlcjE=", "MDQ6VXNlcjI="}, []int{2019, 2018}),
+
+			expectedVariables: map[string]interface{}{
+				"ids":      []interface{}{"MDQ6VXNlcjE=", "MDQ6VXNlcjI="},
+				"from2019": "2019-01-01T00:00:00Z",
+				"to2019":   "2019-12-31T23:59:59Z",
+				"from2018": "2018-01-01T00:00:00Z",
+				"to2018":   "2018-12-31T23:59:59Z",
+			},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			c, err := newClient(&context.Context{})
+			require.NoError(t, err)
+
+			req, err := c.newRequest(test.query, test.variables)
+			require.NoError(t, err)
+
+			assert.Equal(t, DefaultEndpoint, req.URL.String())
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			var payload graphQLRequest
+			require.NoError(t, json.Unmarshal(body, &payload))
+
+			assert.Equal(t, test.query, payload.Query)
+			assert.Equal(t, test.expectedVariables, payload.Variables)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind is the class of an error returned by the GitHub API, which
+// determines whether or not the failed request is worth retrying.
+type ErrorKind int
+
+// All of the classes of errors returned by the GitHub API.
+const (
+	// UnknownError is the class of errors that could not be classified,
+	// such as network errors or malformed responses.
+	UnknownError ErrorKind = iota
+
+	// AuthError means that the credentials are invalid, or that they
+	// don't grant access to the requested resource.
+	AuthError
+
+	// NotFoundError means that the requested resource does not exist,
+	// for example because of a mistyped repository name.
+	NotFoundError
+
+	// RateLimitedError means that the rate limit was exceeded.
+	RateLimitedError
+
+	// TimeoutError means that the GitHub API timed out while
+	// resolving the request.
+	TimeoutError
+
+	// ServerError means that the GitHub API failed to handle the request.
+	ServerError
+
+	// PartialDataError means that only part of the requested data
+	// could be resolved.
+	PartialDataError
+)
+
+// String implements fmt.Stringer.
+func (k ErrorKind) String() string {
+	switch k {
+	case AuthError:
+		return "authentication error"
+	case NotFoundError:
+		return "not found"
+	case RateLimitedError:
+		return "rate limited"
+	case TimeoutError:
+		return "timeout"
+	case ServerError:
+		return "server error"
+	case PartialDataError:
+		return "partial data"
+	default:
+		return "unknown error"
+	}
+}
+
+// APIError is an error returned by the GitHub API.
+type APIError struct {
+	Kind ErrorKind
+
+	// StatusCode is the HTTP status of the response, if any.
+	StatusCode int
+
+	Message string
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// retryable returns whether or not a request that failed with
+// this error might succeed when sent again.
+func (e *APIError) retryable() bool {
+	switch e.Kind {
+	case AuthError, NotFoundError:
+		return false
+	case UnknownError:
+		// Other client errors mean that the request itself is invalid.
+		return e.StatusCode < 400 || e.StatusCode >= 500
+	default:
+		return true
+	}
+}
+
+// KindOf returns the class of the given error, or UnknownError
+// if it is not an error of the GitHub API.
+func KindOf(err error) ErrorKind {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.Kind
+	}
+
+	return UnknownError
+}
+
+// retryable returns whether or not a request that failed with the
+// given error might succeed when sent again. Errors that are not
+// errors of the GitHub API, such as network errors, are retried.
+func retryable(err error) bool {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.retryable()
+	}
+
+	return true
+}
+
+// wrapError returns the given message as an error that has the same
+// class as err, so that context can be added to errors of the GitHub
+// API without losing their class.
+func wrapError(err error, message error) error {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		return message
+	}
+
+	return &APIError{
+		Kind:       apiErr.Kind,
+		StatusCode: apiErr.StatusCode,
+		Message:    message.Error(),
+	}
+}
+
+// statusError returns the error described by a response of the GitHub API
+// with the given status code and body, or nil if the status is a success.
+// Rate limited responses are expected to be handled beforehand.
+func statusError(statusCode int, body []byte) *APIError {
+	if statusCode < 400 {
+		return nil
+	}
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &response)
+
+	message := fmt.Sprintf("unexpected status %d", statusCode)
+	if response.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, response.Message)
+	}
+
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    message,
+	}
+
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		apiErr.Kind = AuthError
+	case statusCode == http.StatusNotFound:
+		apiErr.Kind = NotFoundError
+	case statusCode == http.StatusTooManyRequests:
+		apiErr.Kind = RateLimitedError
+	case statusCode == http.StatusBadGateway || statusCode == http.StatusGatewayTimeout:
+		apiErr.Kind = TimeoutError
+	case statusCode >= 500:
+		apiErr.Kind = ServerError
+	}
+
+	return apiErr
+}
+
+// queryError returns the error described by the errors of a GraphQL response
+// with the given body. When some of the data was resolved in spite of the
+// errors, it is a partial data error, even if the rest of the data timed out.
+func queryError(statusCode int, body []byte, errs []gqlError) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    fmt.Sprintf("error while querying user data: %v [%s:%s]", errs[0].Message, errs[0].Extensions.ArgumentName, errs[0].Extensions.Name),
+	}
+
+	for _, gqlErr := range errs {
+		switch {
+		case gqlErr.Type == "RATE_LIMITED":
+			apiErr.Kind = RateLimitedError
+			return apiErr
+		case gqlErr.Type == "NOT_FOUND" && len(gqlErr.Path) == 1 && gqlErr.Path[0] == "repository":
+			apiErr.Kind = NotFoundError
+			return apiErr
+		}
+	}
+
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(body, &response)
+
+	if len(response.Data) != 0 && string(response.Data) != "null" {
+		apiErr.Kind = PartialDataError
+		return apiErr
+	}
+
+	for _, gqlErr := range errs {
+		message := strings.ToLower(gqlErr.Message)
+		if strings.Contains(message, "timeout") || strings.Contains(message, "timed out") {
+			apiErr.Kind = TimeoutError
+			return apiErr
+		}
+	}
+
+	return apiErr
+}
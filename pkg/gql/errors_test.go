@@ -0,0 +1,228 @@
+package gql
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestParseResponseErrors(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		body       string
+
+		expectedKind    ErrorKind
+		expectedMessage string
+	}{
+		"bad credentials": {
+			statusCode: http.StatusUnauthorized,
+			body:       `{"message":"Bad credentials"}`,
+
+			expectedKind:    AuthError,
+			expectedMessage: "unexpected status 401: Bad credentials",
+		},
+		"missing permissions": {
+			statusCode: http.StatusForbidden,
+			body:       `{"message":"Resource not accessible by integration"}`,
+
+			expectedKind:    AuthError,
+			expectedMessage: "unexpected status 403: Resource not accessible by integration",
+		},
+		"rate limited": {
+			statusCode: http.StatusTooManyRequests,
+
+			expectedKind:    RateLimitedError,
+			expectedMessage: "unexpected status 429",
+		},
+		"bad gateway": {
+			statusCode: http.StatusBadGateway,
+			body:       `<html>502 Bad Gateway</html>`,
+
+			expectedKind:    TimeoutError,
+			expectedMessage: "unexpected status 502",
+		},
+		"server error": {
+			statusCode: http.StatusInternalServerError,
+
+			expectedKind:    ServerError,
+			expectedMessage: "unexpected status 500",
+		},
+		"invalid query": {
+			statusCode: http.StatusBadRequest,
+			body:       `{"message":"Problems parsing JSON"}`,
+
+			expectedKind:    UnknownError,
+			expectedMessage: "unexpected status 400: Problems parsing JSON",
+		},
+		"repository not found": {
+			statusCode: http.StatusOK,
+			body:       `{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],"message":"Could not resolve to a Repository with the name 'ullaakut/astronomr'."}]}`,
+
+			expectedKind:    NotFoundError,
+			expectedMessage: "error while querying user data: Could not resolve to a Repository with the name 'ullaakut/astronomr'. [:]",
+		},
+		"query rate limited": {
+			statusCode: http.StatusOK,
+			body:       `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`,
+
+			expectedKind:    RateLimitedError,
+			expectedMessage: "error while querying user data: API rate limit exceeded [:]",
+		},
+		"query timeout": {
+			statusCode: http.StatusOK,
+			body:       `{"data":null,"errors":[{"message":"Something went wrong while executing your query. This may be the result of a timeout, or it could be a GitHub bug."}]}`,
+
+			expectedKind:    TimeoutError,
+			expectedMessage: "error while querying user data: Something went wrong while executing your query. This may be the result of a timeout, or it could be a GitHub bug. [:]",
+		},
+		"user not found": {
+			statusCode: http.StatusOK,
+			body:       `{"data":{"nodes":[{"login":"titi"},null]},"errors":[{"type":"NOT_FOUND","path":["nodes",1],"message":"Could not resolve to a node with the global id of 'toto'"}]}`,
+
+			expectedKind:    PartialDataError,
+			expectedMessage: "error while querying user data: Could not resolve to a node with the global id of 'toto' [:]",
+		},
+		"contributions timeout": {
+			statusCode: http.StatusOK,
+			body:       `{"data":{"nodes":[{"login":"titi","y2019":null}]},"errors":[{"path":["nodes",0,"y2019"],"message":"Something went wrong while executing your query. This may be the result of a timeout, or it could be a GitHub bug."}]}`,
+
+			expectedKind:    PartialDataError,
+			expectedMessage: "error while querying user data: Something went wrong while executing your query. This may be the result of a timeout, or it could be a GitHub bug. [:]",
+		},
+		"invalid argument": {
+			statusCode: http.StatusOK,
+			body:       `{"errors":[{"message":"Argument 'first' has an invalid value","extensions":{"argumentName":"first","name":"stargazers"}}]}`,
+
+			expectedKind:    UnknownError,
+			expectedMessage: "error while querying user data: Argument 'first' has an invalid value [first:stargazers]",
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: test.statusCode,
+				Body:       ioutil.NopCloser(strings.NewReader(test.body)),
+			}
+
+			response, body, err := parseResponse(resp)
+			require.Error(t, err)
+
+			// Partial data is returned along with the error.
+			assert.Equal(t, test.expectedKind == PartialDataError, response != nil)
+			assert.Equal(t, test.body, string(body))
+			assert.Equal(t, test.expectedKind, KindOf(err))
+			assert.Equal(t, test.expectedMessage, err.Error())
+		})
+	}
+}
+
+func TestQueryRetriesPerErrorClass(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+
+	tests := map[string]struct {
+		statusCode int
+		body       string
+		splittable bool
+
+		expectedKind     ErrorKind
+		expectedRequests int32
+	}{
+		"bad credentials are not retried": {
+			statusCode: http.StatusUnauthorized,
+			body:       `{"message":"Bad credentials"}`,
+
+			expectedKind:     AuthError,
+			expectedRequests: 1,
+		},
+		"missing repositories are not retried": {
+			statusCode: http.StatusOK,
+			body:       `{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],"message":"Could not resolve to a Repository"}]}`,
+
+			expectedKind:     NotFoundError,
+			expectedRequests: 1,
+		},
+		"invalid queries are not retried": {
+			statusCode: http.StatusUnprocessableEntity,
+
+			expectedKind:     UnknownError,
+			expectedRequests: 1,
+		},
+		"server errors are retried": {
+			statusCode: http.StatusInternalServerError,
+
+			expectedKind:     ServerError,
+			expectedRequests: maxAttempts,
+		},
+		"timeouts are retried": {
+			statusCode: http.StatusBadGateway,
+
+			expectedKind:     TimeoutError,
+			expectedRequests: maxAttempts,
+		},
+		"timeouts of splittable queries are retried a few times": {
+			statusCode: http.StatusBadGateway,
+			splittable: true,
+
+			expectedKind:     TimeoutError,
+			expectedRequests: maxTimeouts,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.WriteHeader(test.statusCode)
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+
+			c, err := newClient(&context.Context{
+				GraphQLEndpoint: server.URL,
+				GithubTokens:    []string{"fakeToken"},
+			})
+			require.NoError(t, err)
+
+			req, err := c.newRequest(fetchUsersQuery, nil)
+			require.NoError(t, err)
+
+			if test.splittable {
+				_, _, err = c.querySplittable(gocontext.Background(), req)
+			} else {
+				_, _, err = c.query(gocontext.Background(), req)
+			}
+			require.Error(t, err)
+
+			assert.Equal(t, test.expectedKind, KindOf(err))
+			assert.Equal(t, test.expectedRequests, atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	apiErr := &APIError{Kind: NotFoundError, StatusCode: http.StatusNotFound, Message: "unexpected status 404"}
+
+	err := wrapError(apiErr, errors.New("failed to fetch stargazers: unexpected status 404"))
+	assert.Equal(t, NotFoundError, KindOf(err))
+	assert.Equal(t, "failed to fetch stargazers: unexpected status 404", err.Error())
+	assert.False(t, retryable(err))
+
+	err = wrapError(errors.New("connection reset"), errors.New("failed to fetch stargazers: connection reset"))
+	assert.Equal(t, UnknownError, KindOf(err))
+	assert.Equal(t, "failed to fetch stargazers: connection reset", err.Error())
+	assert.True(t, retryable(err))
+}
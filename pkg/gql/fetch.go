@@ -1,475 +1,1081 @@
 package gql
 
 import (
-	"bytes"
+	gocontext "context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"net/http"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Ullaakut/astronomer/pkg/context"
 	"github.com/Ullaakut/disgo"
 	"github.com/Ullaakut/disgo/style"
-	"github.com/cenkalti/backoff/v3"
 	"github.com/vbauerster/mpb/v4"
 	"github.com/vbauerster/mpb/v4/decor"
 )
 
 const year = 24 * time.Hour * 365
 
-var (
-	rateLimitSleepDuration time.Duration
+// FetchStargazers lists every stargazer of the repository, and selects
+// the ones for which to fetch contributions. It stops as soon as cancelCtx
+// is cancelled.
+func FetchStargazers(cancelCtx gocontext.Context, ctx *context.Context) (sample []Stargazer, totalUsers uint, err error) {
+	// When resuming a scan, reuse the exact same sample of stargazers.
+	if ctx.Resume {
+		plan, err := loadScanPlan(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
 
-	// blacklistedUsers contains the list of users that can't be
-	// fetched from the GitHub API. When one of these users is found
-	// in a list request, he must be skipped when fetching user contributions
-	// or astronomer will be stuck due to constant API timeouts.
-	blacklistedUsers = []string{
-		// "jstrachan", // has been fixed.
-	}
-)
+		if plan != nil {
+			ctx.Stars = plan.Stars
+			ctx.ScanAll = plan.ScanAll
+			ctx.Seed = plan.Seed
+			ctx.Population = plan.TotalUsers
 
-// FetchStargazers fetches the list of cursors to iterate upon to
-// fetch stargazer contributions.
-func FetchStargazers(ctx *context.Context) (cursors []string, totalUsers uint, err error) {
-	var (
-		stargazers     []stargazers
-		lastCursor     string
-		page           int
-		rateLimitSleep time.Duration
-	)
+			disgo.Infof("Resuming previous scan of %d stargazers (%d/%d pages already fetched)\n", plan.TotalUsers, len(plan.Completed), len(samplePages(plan.Stargazers)))
+			return plan.Stargazers, plan.TotalUsers, nil
+		}
+
+		disgo.Infoln(style.Important("No scan to resume, starting a new scan"))
+	}
 
 	if ctx.Stars < uint(contribPagination) {
 		return nil, 0, fmt.Errorf("unable to compute less stars than the amount fetched per page. Please set stars to at least %d", contribPagination)
 	}
 
-	// Round amount of stars to get according to pagination.
-	if ctx.Stars%contribPagination != 0 {
-		ctx.Stars = ctx.Stars - ctx.Stars%contribPagination
-		disgo.Errorln(style.Failure("Rounding amount of stars to fetch to ", ctx.Stars, " in order to match pagination"))
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// Inject constants in request body.
-	requestBody := buildRequestBody(ctx, fetchUsersRequest, listPagination)
-	client := &http.Client{}
+	client.tokens.onPause = func(status string) {
+		disgo.Infoln(style.Important(status))
+	}
 
-	disgo.StartStep("Pre-fetching all stargazers")
+	// When updating a previous scan, only the stargazers that starred the
+	// repository since then are listed.
+	if ctx.Incremental {
+		plan, err := loadScanPlan(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if plan != nil && plan.LastCursor != "" {
+			return fetchNewStargazers(cancelCtx, ctx, client, plan)
+		}
+
+		disgo.Infoln(style.Important("No previous scan to update, starting a new scan"))
+	}
+
+	disgo.StartStep("Pre-fetching stargazers")
 
 	defer disgo.EndStep()
 
-	for {
-		var response *listStargazersResponse
+	// The same seed always selects the same sample of stargazers, so
+	// that reports can be reproduced.
+	if ctx.Seed == 0 {
+		ctx.Seed = time.Now().UnixNano()
+	}
 
-		page++
+	// Listing every stargazer is only needed when they are all scanned.
+	// Otherwise, the sample is fetched directly.
+	latest, err := fetchLatestStargazers(cancelCtx, ctx, client, "")
+	if err != nil {
+		return nil, 0, err
+	}
 
-		paginatedRequestBody := requestBody
-		if lastCursor != "" {
-			paginatedRequestBody = strings.Replace(
-				paginatedRequestBody,
-				fmt.Sprintf("stargazers(first:%d){", listPagination),
-				fmt.Sprintf("stargazers(first:%d,after:\\\"%s\\\"){", listPagination, lastCursor),
-				1)
+	var lastCursor string
+	population := populationOf(ctx, latest.TotalCount)
+	if isSampled(ctx, population) {
+		totalUsers = uint(population)
+		sample, lastCursor, err = sampleStargazers(cancelCtx, ctx, client, latest, population, ctx.Seed)
+		if err != nil {
+			return nil, 0, err
 		}
-
-		req, err := http.NewRequest("POST", "https://api.github.com/graphql", bytes.NewBuffer([]byte(paginatedRequestBody)))
+	} else {
+		var all []Stargazer
+		all, lastCursor, err = listStargazers(cancelCtx, ctx, client, "")
 		if err != nil {
-			return nil, 0, disgo.FailStepf("unable to prepare request: %v", err)
+			return nil, 0, err
 		}
 
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ctx.GithubToken))
-		req.Header.Set("User-Agent", "Astronomer")
+		if population < len(all) {
+			all = all[:population]
+		}
+
+		totalUsers = uint(len(all))
+		sample = selectStargazers(ctx, all, ctx.Seed)
+	}
+
+	// Stargazers that starred the repository after the population were
+	// neither counted nor selected, so there is no cursor after which to
+	// list new stargazers when updating the scan.
+	if int(totalUsers) < latest.TotalCount {
+		lastCursor = ""
+	}
+	ctx.Population = totalUsers
+
+	// Persist the selected sample, so that the scan can be resumed
+	// if it gets interrupted, or updated later on.
+	plan := &scanPlan{
+		Stars:      ctx.Stars,
+		ScanAll:    ctx.ScanAll,
+		Seed:       ctx.Seed,
+		Stargazers: sample,
+		TotalUsers: totalUsers,
+		LastCursor: lastCursor,
+	}
+
+	err = plan.save(ctx)
+	if err != nil {
+		return nil, 0, disgo.FailStepf("unable to save scan plan: %v", err)
+	}
+
+	return sample, totalUsers, nil
+}
+
+// fetchNewStargazers lists the stargazers that starred the repository since
+// the given scan, and adds them to its sample at the rate at which the scan
+// selected random stargazers, so that the sample stays evenly spread over
+// the stargazer timeline. Previously selected stargazers are kept in the
+// same order, so that their contributions are found in the cache.
+func fetchNewStargazers(cancelCtx gocontext.Context, ctx *context.Context, client *client, plan *scanPlan) ([]Stargazer, uint, error) {
+	ctx.Stars = plan.Stars
+	ctx.ScanAll = plan.ScanAll
+	ctx.Seed = plan.Seed
+
+	disgo.StartStep("Fetching new stargazers")
+
+	defer disgo.EndStep()
+
+	newStargazers, lastCursor, err := listStargazers(cancelCtx, ctx, client, plan.LastCursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	disgo.Infof("Found %d new stargazers since the last scan of %d stargazers\n", len(newStargazers), plan.TotalUsers)
+
+	sample := append([]Stargazer(nil), plan.Stargazers...)
+	sample = append(sample, selectNewStargazers(ctx, plan, newStargazers)...)
+
+	updated := &scanPlan{
+		Stars:      plan.Stars,
+		ScanAll:    plan.ScanAll,
+		Seed:       plan.Seed,
+		Stargazers: sample,
+		TotalUsers: plan.TotalUsers + uint(len(newStargazers)),
+		LastCursor: lastCursor,
+	}
+
+	err = updated.save(ctx)
+	if err != nil {
+		return nil, 0, disgo.FailStepf("unable to save scan plan: %v", err)
+	}
+
+	ctx.Population = updated.TotalUsers
+
+	return updated.Stargazers, updated.TotalUsers, nil
+}
+
+// selectNewStargazers selects the stargazers to add to the sample of the
+// given scan among the ones that starred the repository since then, at the
+// rate at which the scan selected random stargazers. Selected stargazers
+// belong to the latest slice of the stargazer timeline. The same scan and
+// new stargazers always result in the same selection. ctx must have the
+// options of the given scan.
+func selectNewStargazers(ctx *context.Context, plan *scanPlan, newStargazers []Stargazer) []Stargazer {
+	// Scans of up to 219 stargazers have no slices, in which case
+	// new stargazers start the first one.
+	stratum := 1
+	var random int
+	for _, stargazer := range plan.Stargazers {
+		if stargazer.Stratum != 0 {
+			stratum = stargazer.Stratum
+			random++
+		}
+	}
+
+	// When every stargazer was scanned, so is every new stargazer.
+	pool := int(plan.TotalUsers) - firstStargazers(ctx)
+	if plan.ScanAll || len(plan.Stargazers) >= int(plan.TotalUsers) || pool <= 0 {
+		selected := make([]Stargazer, 0, len(newStargazers))
+		for _, stargazer := range newStargazers {
+			stargazer.Stratum = stratum
+			selected = append(selected, stargazer)
+		}
+
+		return selected
+	}
+
+	// Each update of the scan picks new stargazers with another seed,
+	// derived from the seed of the scan.
+	amount := int(math.Round(float64(len(newStargazers)) * float64(random) / float64(pool)))
+	picks, _ := pickStratified(len(newStargazers), amount, 1, plan.Seed+int64(plan.TotalUsers))
+
+	var selected []Stargazer
+	for _, pick := range picks {
+		stargazer := newStargazers[pick]
+		stargazer.Stratum = stratum
+		selected = append(selected, stargazer)
+	}
+
+	return selected
+}
+
+// listStargazers lists the stargazers of the repository that starred it
+// after the given cursor, either from the cache or from the GitHub API. It
+// also returns the cursor of the last stargazer, or the given cursor if
+// there are no stargazers after it.
+func listStargazers(cancelCtx gocontext.Context, ctx *context.Context, client *client, cursor string) ([]Stargazer, string, error) {
+	var all []Stargazer
+
+	lastCursor := cursor
+	for {
+		req, err := client.newRequest(fetchUsersQuery, listStargazersVariables(ctx, listPagination, lastCursor))
+		if err != nil {
+			return nil, "", disgo.FailStepf("unable to prepare request: %v", err)
+		}
 
 		// Attempt to find the response to this specific request already stored
 		// in the cache directory.
 		resp, err := getCache(ctx, req, listFilePagination(lastCursor))
 		if err != nil {
-			return nil, 0, disgo.FailStepf("unable to get cached file: %v", err)
+			return nil, "", disgo.FailStepf("unable to get cached file: %v", err)
 		}
 
 		response, responseBody, _ := parseResponse(resp)
 
-		// If the request was not found in the cache, try to fetch it until it works
-		// or until the limit of 20 attempts is reached.
-		if resp == nil {
-			var attempts int
-			err = backoff.Retry(func() error {
-				// If we reached 20 attempts, give up.
-				attempts++
-				if attempts >= 20 {
-					disgo.Errorln("Failed to fetch stargazers from GitHub API too many times.")
-					return nil
-				}
+		// Responses cached before star dates and node IDs were fetched need
+		// to be fetched again. So does the last page, which was not full and
+		// might contain new stargazers since it was cached.
+		cachedFileFound := response != nil &&
+			response.Repository.Stargazers.hasStarDates() &&
+			response.Repository.Stargazers.hasIDs() &&
+			len(response.Repository.Stargazers.Users) == listPagination
+
+		// If the request was not found in the cache, try to fetch it until it works.
+		if !cachedFileFound {
+			response, responseBody, err = client.query(cancelCtx, req)
+			if cancelCtx.Err() != nil {
+				return nil, "", disgo.FailStepf("scan interrupted: %v", cancelCtx.Err())
+			}
+
+			if err != nil {
+				return nil, "", wrapError(err, disgo.FailStepf("failed to fetch stargazers: %v. last body recieved: %s", err, responseBody))
+			}
+
+			// Since we arrived here, we got a successful response, so we store it
+			// in the cache directory.
+			err = putCache(ctx, req, listFilePagination(lastCursor), responseBody)
+			if err != nil {
+				return nil, "", disgo.FailStepf("unable to write user contribution data to cache: %v", err)
+			}
+		}
 
-				// If rate limit was reached, sleep before making a request.
-				// If rate limit was not reached, rateLimitSleep will be set to zero.
-				time.Sleep(rateLimitSleep)
+		for _, user := range response.Repository.Stargazers.Users {
+			all = append(all, Stargazer{
+				ID:        user.ID,
+				StarredAt: user.StarredAt,
+			})
+		}
 
-				resp, err = client.Do(req)
-				if err != nil {
-					return fmt.Errorf("unable to fetch stargazers: %v", err)
+		if pageCursor := response.Repository.Stargazers.Meta.cursor(); pageCursor != "" {
+			lastCursor = pageCursor
+		}
+
+		if len(response.Repository.Stargazers.Users) < listPagination {
+			return all, lastCursor, nil
+		}
+	}
+}
+
+// FetchContributions fetches the contribution data of a sample of stargazers,
+// by pages of stargazers that are fetched by node ID, back until the given
+// year. It also returns the stargazers of the sample that were dropped
+// because some of their data could not be fetched. If cancelCtx is
+// cancelled, it stops fetching and returns the users for which every
+// contribution was already fetched, along with the context's error.
+func FetchContributions(cancelCtx gocontext.Context, ctx *context.Context, sample []Stargazer, untilYear int) ([]User, []DroppedUser, error) {
+	var users []User
+
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := contributionsPlan(ctx, sample, untilYear)
+	if err != nil {
+		return nil, nil, err
+	}
+	untilYear = plan.UntilYear
+
+	skipped, err := loadSkipList(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	avatars, err := loadAvatarCache(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dropped := &droppedUsers{}
+
+	progress, bar := setupProgressBar(len(sample), client.tokens)
+	defer progress.Wait()
+
+	pages := samplePages(sample)
+	totalPages := len(pages)
+
+	// Get all user contributions for each year.
+	currentYear := time.Now().Year()
+	var years []int
+	for y := currentYear; y > untilYear-1; y-- {
+		years = append(years, y)
+	}
+
+	// Each page of user contributions, following the order of the sample
+	// selected in FetchStargazers, is fetched for all years at once. Responses are
+	// stored by page and by year so that they can be merged in a
+	// deterministic order once all workers are done.
+	responses := make([][]*listStargazersResponse, totalPages)
+	errs := make([]error, totalPages)
+	jobs := make(chan contributionJob)
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+	for i := 0; i < workerCount(ctx); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				// Once a page failed to be fetched, the scan is aborted, so
+				// there is no need to fetch the remaining pages.
+				if atomic.LoadInt32(&failed) != 0 || cancelCtx.Err() != nil {
+					continue
 				}
 
-				if resp == nil {
-					return errors.New("nil response")
+				pageResponses, err := fetchContributionPage(cancelCtx, ctx, client, skipped, dropped, avatars, job, years)
+
+				// Keep track of the progress of the scan.
+				if err == nil {
+					plan.markCompleted(job.key)
+					err = plan.save(ctx)
 				}
 
-				response, responseBody, err = parseResponse(resp)
 				if err != nil {
-					return err
+					atomic.StoreInt32(&failed, 1)
 				}
 
-				if len(response.Errors) != 0 || response.ErrorMessage != "" {
-					if response.ErrorMessage != "" {
-						return errors.New(response.ErrorMessage)
-					}
-					return errors.New(response.Errors[0].Message)
-				}
+				responses[job.page] = pageResponses
+				errs[job.page] = err
 
-				if len(response.Repository.Stargazers.Users) == 0 {
-					resp.Body.Close()
-					return nil
-				}
+				// Update progress bar.
+				bar.IncrBy(len(job.stargazers))
+			}
+		}()
+	}
 
-				return nil
-			}, backoff.NewConstantBackOff(15*time.Second))
+queueing:
+	for page := 0; page < totalPages; page++ {
+		job := contributionJob{
+			page:       page,
+			key:        pageKey(pages[page]),
+			stargazers: pages[page],
 		}
 
-		if response == nil || err != nil {
-			return nil, 0, fmt.Errorf("failed to fetch stargazers. last body recieved: %s", responseBody)
+		select {
+		case jobs <- job:
+		case <-cancelCtx.Done():
+			break queueing
 		}
+	}
+	close(jobs)
+
+	// Wait for in-flight requests to be done and written to the cache.
+	wg.Wait()
 
-		stargazers = append(stargazers, response.Repository.Stargazers)
+	bar.Abort(true)
 
-		if len(response.Errors) != 0 || response.ErrorMessage != "" {
-			disgo.Errorln("Errors:", response.ErrorMessage, response.Errors)
-			return nil, 0, disgo.FailStepf("failed to fetch user contributions. last body recieved: %s", responseBody)
+	// Update list of users with users from responses, in the order in
+	// which pages and years were requested.
+	for page := range responses {
+		// If the scan was interrupted, pages that are incomplete are skipped.
+		// Errors are expected, since in-flight requests get cancelled.
+		if cancelCtx.Err() != nil {
+			if responses[page] != nil && errs[page] == nil {
+				users = mergePage(users, responses[page], years)
+			}
+			continue
 		}
 
-		// Since we arrived here, we got a successful response, so we store it
-		// in the cache directory.
-		err = putCache(ctx, req, listFilePagination(lastCursor), responseBody)
-		if err != nil {
-			return nil, 0, disgo.FailStepf("unable to write user contribution data to cache: %v", err)
+		if errs[page] != nil {
+			return nil, nil, errs[page]
 		}
 
-		lastCursor = response.Repository.Stargazers.Meta.cursor()
+		users = mergePage(users, responses[page], years)
+	}
 
-		totalUsers += uint(len(response.Repository.Stargazers.Users))
+	// Users that were skipped or dropped for some years would have
+	// incomplete contributions.
+	users = dropped.filter(skipped.filter(users, dropped))
 
-		if len(response.Repository.Stargazers.Users) < listPagination {
-			break
+	if cancelCtx.Err() != nil {
+		return users, dropped.list(), cancelCtx.Err()
+	}
+
+	return users, dropped.list(), nil
+}
+
+// mergePage updates a list of users with the responses of each year
+// for a page of stargazers.
+func mergePage(users []User, responses []*listStargazersResponse, years []int) []User {
+	for idx, year := range years {
+		if responses[idx] == nil {
+			continue
 		}
 
-		// Set the rate limit sleep duration depending on the token's limit.
-		rateLimitSleepDuration = time.Hour / time.Duration(response.RateLimit.Limit)
+		users = updateUsers(users, *responses[idx], year)
+	}
 
-		if response.RateLimit.Remaining <= 10 {
-			disgo.Debugln("Rate limit reached, slowing down requests")
-			rateLimitSleep = rateLimitSleepDuration
+	return users
+}
+
+// contributionsPlan returns the plan of the scan for which contributions
+// are being fetched. When resuming a scan, contributions are fetched until
+// the year that was used by the interrupted scan.
+func contributionsPlan(ctx *context.Context, sample []Stargazer, untilYear int) (*scanPlan, error) {
+	plan, err := loadScanPlan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stargazers might not have been fetched by FetchStargazers.
+	if plan == nil || !plan.matches(sample) {
+		plan = &scanPlan{
+			Stars:      ctx.Stars,
+			ScanAll:    ctx.ScanAll,
+			Stargazers: sample,
 		}
 	}
 
-	cursors = getCursors(ctx, stargazers, totalUsers)
+	if ctx.Resume && plan.UntilYear != 0 {
+		if plan.UntilYear != untilYear {
+			disgo.Infof("Resuming scan with contributions up to year %d\n", plan.UntilYear)
+		}
+
+		// Trust is computed according to the years that were fetched.
+		ctx.SinceYear = plan.UntilYear
+		return plan, nil
+	}
+
+	plan.UntilYear = untilYear
+	plan.Completed = nil
 
-	return cursors, totalUsers, nil
+	err = plan.save(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to save scan plan: %v", err)
+	}
+
+	return plan, nil
 }
 
-// FetchContributions fetches the contribution data of a list of stargazers.
-// ctx contains the scanned context of the astronomer command.
-// untilYear is the year until which to scan for contribuitons.
-func FetchContributions(ctx *context.Context, cursors []string, untilYear int) ([]User, error) {
-	var (
-		users          []User
-		rateLimitSleep time.Duration
-	)
+// samplePages splits a sample of stargazers in pages of stargazers for
+// which contributions are fetched at once.
+func samplePages(sample []Stargazer) [][]Stargazer {
+	var pages [][]Stargazer
+	for start := 0; start < len(sample); start += contribPagination {
+		end := start + contribPagination
+		if end > len(sample) {
+			end = len(sample)
+		}
 
-	requestBody := buildRequestBody(ctx, fetchContributionsRequest, contribPagination)
-	client := &http.Client{}
+		pages = append(pages, sample[start:end])
+	}
 
-	progress, bar := setupProgressBar(len(cursors))
-	defer progress.Wait()
+	return pages
+}
+
+// pageKey returns the key that identifies a page of stargazers in the
+// cache directory and in the scan plan.
+func pageKey(page []Stargazer) string {
+	var ids []string
+	for _, stargazer := range page {
+		ids = append(ids, stargazer.ID)
+	}
 
-	// If we are scanning only a portion of stargazers, the
-	// scan does not start with a page without a cursor.
-	isReverseOrder := uint(len(cursors)) > ctx.Stars/contribPagination
+	return hashIDs(ids)
+}
 
-	totalPages := len(cursors)
+// contributionJob represents the fetching of the contributions of
+// a single page of stargazers.
+type contributionJob struct {
+	page       int
+	key        string
+	stargazers []Stargazer
+}
 
-	// If we don't scan in reverse order (first stars first), we
-	// have fetch each page pointed at by the cursors, plus the first
-	// page which doesn't require a cursor.
-	if !isReverseOrder {
-		totalPages++
+// fetchContributionPage fetches the profiles and contributions of a page of
+// stargazers for each of the given years, either from the cache or from the
+// GitHub API. It returns one response per year. Contributions are only
+// fetched for the years during which any stargazer of the page could have
+// contributed.
+func fetchContributionPage(cancelCtx gocontext.Context, ctx *context.Context, client *client, skipped *skipList, dropped *droppedUsers, avatars *avatarCache, job contributionJob, years []int) ([]*listStargazersResponse, error) {
+	page, err := planPage(cancelCtx, ctx, client, dropped, job)
+	if err != nil {
+		return nil, err
 	}
 
-	// Iterate on pages of user contributions, following the cursors generated
-	// in fetchStargazers.
-	for page := 1; page <= totalPages; page++ {
-		currentCursor := getCursor(cursors, page, isReverseOrder)
+	err = avatars.setDefaultAvatars(cancelCtx, ctx, client.httpClient, page.Users)
+	if err != nil {
+		return nil, err
+	}
 
-		// If this isn't the first page, inject the cursor value.
-		paginatedRequestBody := requestBody
-		if currentCursor != "firstpage" {
-			paginatedRequestBody = strings.Replace(
-				paginatedRequestBody,
-				fmt.Sprintf("stargazers(first:%d){", contribPagination),
-				fmt.Sprintf("stargazers(first:%d,after:\\\"%s\\\"){", contribPagination, currentCursor),
-				1,
-			)
+	fetched := make(map[string]map[int]contributions)
+	if batch := planBatch(page.Users, years, skipped); len(batch.users) != 0 {
+		err = fetchContributionBatch(cancelCtx, ctx, client, skipped, dropped, job, batch, fetched)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		// Get all user contributions for each year.
-		currentYear := time.Now().Year()
-		for i := 0; currentYear-i > untilYear-1; i++ {
-			// Inject the dates corresponding to the year we're scanning, into the request body.
-			from := time.Date(currentYear-i, time.January, 1, 0, 0, 0, 0, time.UTC)
-			to := from.Add(year - 1*time.Second)
+	return pageResponses(page, fetched, years), nil
+}
 
-			yearlyRequestBody := strings.Replace(paginatedRequestBody, "$dateFrom", from.Format(iso8601Format), 1)
-			yearlyRequestBody = strings.Replace(yearlyRequestBody, "$dateTo", to.Format(iso8601Format), 1)
+// planPage fetches the profiles of a page of stargazers by node ID, along
+// with the years during which they contributed, either from the cache or
+// from the GitHub API. Users that no longer exist, or whose profile could
+// not be resolved, are dropped.
+func planPage(cancelCtx gocontext.Context, ctx *context.Context, client *client, dropped *droppedUsers, job contributionJob) (*stargazers, error) {
+	var ids []string
+	for _, stargazer := range job.stargazers {
+		ids = append(ids, stargazer.ID)
+	}
 
-			// Prepare the HTTP request.
-			req, err := http.NewRequest("POST", "https://api.github.com/graphql", bytes.NewBuffer([]byte(yearlyRequestBody)))
-			if err != nil {
-				return nil, fmt.Errorf("unable to prepare request: %v", err)
-			}
+	profiles, err := fetchProfiles(cancelCtx, ctx, client, dropped, job, ids, 0)
+	if err != nil {
+		return nil, err
+	}
 
-			// Inject GitHub token for API authorization.
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ctx.GithubToken))
-			req.Header.Set("User-Agent", "Astronomer")
+	resolved := make(map[string]User)
+	for _, user := range profiles {
+		resolved[user.ID] = user
+	}
 
-			// Try to get a cached response to this request.
-			resp, err := getCache(ctx, req, contribFilePagination(currentCursor, currentYear-i))
+	// Profiles don't contain the star dates, which are only known from the
+	// list of stargazers. Retried profiles are put back in the order of
+	// the sample.
+	page := &stargazers{}
+	for _, stargazer := range job.stargazers {
+		user, ok := resolved[stargazer.ID]
+		if !ok {
+			continue
+		}
+
+		user.StarredAt = stargazer.StarredAt
+		user.Stratum = stargazer.Stratum
+		page.Users = append(page.Users, user)
+	}
+
+	return page, nil
+}
+
+// fetchProfiles fetches the profiles of the users with the given IDs, either
+// from the cache or from the GitHub API. When only some of the profiles could
+// be resolved, the others are fetched again, up to maxPartialRetries times
+// before being dropped.
+func fetchProfiles(cancelCtx gocontext.Context, ctx *context.Context, client *client, dropped *droppedUsers, job contributionJob, ids []string, retries int) ([]User, error) {
+	req, err := client.newRequest(planContributionsQuery, usersVariables(ids))
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare request: %v", err)
+	}
+
+	pagination := retryFilePagination(planFilePagination(hashIDs(ids)), retries)
+	resp, err := getCache(ctx, req, pagination)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cached file: %v", err)
+	}
+
+	response, responseBody, _ := parseResponse(resp)
+	if response == nil || transientFailures(responseBody, len(ids)) {
+		_, responseBody, err = client.query(cancelCtx, req)
+		if cancelCtx.Err() != nil {
+			return nil, cancelCtx.Err()
+		}
+
+		if err != nil && KindOf(err) != PartialDataError {
+			disgo.Debugf("Last body received: %s\n", responseBody)
+			return nil, wrapError(err, fmt.Errorf("failed to fetch stargazer profiles. failed at page %s: %v", job.key, err))
+		}
+
+		// Partial responses are only cached when the profiles that could
+		// not be resolved never will be, such as those of deleted users.
+		if !transientFailures(responseBody, len(ids)) {
+			err = putCache(ctx, req, pagination, responseBody)
 			if err != nil {
-				return nil, fmt.Errorf("unable to get cached file: %v", err)
+				return nil, fmt.Errorf("unable to write stargazer profiles to cache: %v", err)
 			}
+		}
+	}
 
-			response, responseBody, _ := parseResponse(resp)
-
-			cachedFileFound := resp != nil
-
-			// If the request was not found in the cache, try to fetch it until it works
-			// or until the limit of 20 attempts is reached.
-			if !cachedFileFound {
-				var attempts int
-				err = backoff.Retry(func() error {
-					// If we reached 20 attempts, give up.
-					attempts++
-					if attempts >= 20 {
-						disgo.Errorln("Failed to fetch user contributions from GitHub API too many times.")
-						return nil
-					}
-
-					// If rate limit was reached, sleep before making a request.
-					// If rate limit was not reached, rateLimitSleep will be set to zero.
-					time.Sleep(rateLimitSleep)
-
-					resp, err = client.Do(req)
-					if err != nil {
-						return fmt.Errorf("unable to fetch stargazer contributions: %v", err)
-					}
-
-					if resp == nil {
-						return errors.New("nil response")
-					}
-
-					response, responseBody, err = parseResponse(resp)
-					if err != nil {
-						return fmt.Errorf("unable to parse response: %v", err)
-					}
-
-					if len(response.Errors) != 0 || response.ErrorMessage != "" {
-						if response.ErrorMessage != "" {
-							return errors.New(response.ErrorMessage)
-						}
-						return errors.New(response.Errors[0].Message)
-					}
-
-					// If there is no error and no users in the response body, it must mean
-					// that we reached the end of the user list.
-					if len(response.Repository.Stargazers.Users) == 0 {
-						resp.Body.Close()
-						return nil
-					}
-
-					return nil
-				}, backoff.NewConstantBackOff(15*time.Second))
-			}
+	var profiles usersResponse
+	err = json.Unmarshal(responseBody, &profiles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal stargazer profiles: %v", err)
+	}
+
+	failures, err := nodeFailures(responseBody, len(ids))
+	if err != nil {
+		return nil, err
+	}
 
-			if response == nil || err != nil {
-				return nil, fmt.Errorf("failed to fetch user contributions. failed at cursor %s", currentCursor)
+	var (
+		users []User
+		retry []string
+	)
+	for idx, id := range ids {
+		gqlErr, failed := failures[idx]
+		switch {
+		case !failed:
+			if idx < len(profiles.Data.Nodes) {
+				users = append(users, profiles.Data.Nodes[idx])
 			}
+		case gqlErr.retryable() && retries < maxPartialRetries:
+			retry = append(retry, id)
+		default:
+			dropped.add(DroppedUser{ID: id, Reason: gqlErr.reason()})
+		}
+	}
 
-			// Update list of users with users from reponse.
-			users = updateUsers(users, *response, currentYear-i)
+	if len(retry) == 0 {
+		return users, nil
+	}
 
-			if len(response.Errors) != 0 || response.ErrorMessage != "" {
-				disgo.Errorln("Errors:", response.ErrorMessage, response.Errors)
-				return nil, fmt.Errorf("failed to fetch user contributions. failed at cursor %s", currentCursor)
-			}
+	retried, err := fetchProfiles(cancelCtx, ctx, client, dropped, job, retry, retries+1)
+	if err != nil {
+		return nil, err
+	}
 
-			// If file was fetched, write it in the cache. If we already got it from the cache,
-			// no need to rewrite it.
-			if !cachedFileFound {
-				err = putCache(ctx, req, contribFilePagination(currentCursor, currentYear-i), responseBody)
-				if err != nil {
-					return users, fmt.Errorf("unable to write user contribution data to cache: %v", err)
-				}
+	return append(users, retried...), nil
+}
+
+// contributionBatch is a group of stargazers of a page for which
+// contributions are fetched during the same years, in a single query.
+type contributionBatch struct {
+	users []User
+	years []int
+
+	// retries is the amount of times the users of the batch were already
+	// fetched, because their contributions were missing from a partial
+	// response.
+	retries int
+}
+
+// planBatch plans the batch of the given users of a page, for which
+// contributions are fetched during the range of years in which any of them
+// could have contributed, among the given years. Fetching a few years too
+// many for some users is cheaper than sending one query per range of years.
+// Users that never contributed during those years, and skipped users, are
+// left out.
+func planBatch(users []User, years []int, skipped *skipList) contributionBatch {
+	var (
+		batch       contributionBatch
+		first, last int
+	)
+	for _, user := range users {
+		if skipped.contains(user.Login, years...) {
+			continue
+		}
+
+		activeYears := user.activeYears(years)
+		if len(activeYears) == 0 {
+			continue
+		}
+
+		for _, year := range activeYears {
+			if first == 0 || year < first {
+				first = year
 			}
+			if year > last {
+				last = year
+			}
+		}
 
-			// If we approach the rate limit, slow the requests down.
-			if response.RateLimit.Remaining <= 10 {
-				disgo.Infoln("Rate limit reached, slowing down requests")
-				rateLimitSleep = rateLimitSleepDuration
+		batch.users = append(batch.users, user)
+	}
+
+	for _, year := range years {
+		if year >= first && year <= last {
+			batch.years = append(batch.years, year)
+		}
+	}
+
+	return batch
+}
+
+// fetchContributionBatch fetches the contributions of a batch of users,
+// either from the cache or from the GitHub API, and adds them to the
+// given contributions of each user by year. If the GitHub API keeps
+// timing out, the batch is split until the users responsible for the
+// timeouts are isolated, and those users are added to the skip list.
+// When the contributions of only some of the users could be resolved,
+// the others are fetched again, up to maxPartialRetries times before
+// being dropped.
+func fetchContributionBatch(cancelCtx gocontext.Context, ctx *context.Context, client *client, skipped *skipList, dropped *droppedUsers, job contributionJob, batch contributionBatch, fetched map[string]map[int]contributions) error {
+	var ids []string
+	for _, user := range batch.users {
+		ids = append(ids, user.ID)
+	}
+
+	// Prepare the HTTP request.
+	req, err := client.newRequest(contributionsQuery(batch.years), contributionsVariables(ids, batch.years))
+	if err != nil {
+		return fmt.Errorf("unable to prepare request: %v", err)
+	}
+
+	// Try to get a cached response to this request.
+	pagination := retryFilePagination(contribFilePagination(ids, batch.years), batch.retries)
+	resp, err := getCache(ctx, req, pagination)
+	if err != nil {
+		return fmt.Errorf("unable to get cached file: %v", err)
+	}
+
+	response, responseBody, _ := parseResponse(resp)
+	cachedFileFound := response != nil && !transientFailures(responseBody, len(ids))
+
+	// If the request was not found in the cache, try to fetch it until it works.
+	if !cachedFileFound {
+		response, responseBody, err = client.querySplittable(cancelCtx, req)
+		if cancelCtx.Err() != nil {
+			return cancelCtx.Err()
+		}
+
+		if err == errTimeout {
+			return splitContributionBatch(cancelCtx, ctx, client, skipped, dropped, job, batch, fetched)
+		}
+
+		if err != nil && KindOf(err) != PartialDataError {
+			disgo.Debugf("Last body received: %s\n", responseBody)
+			return wrapError(err, fmt.Errorf("failed to fetch user contributions. failed at page %s: %v", job.key, err))
+		}
+
+		// Partial responses are only cached when the contributions that
+		// could not be resolved never will be, such as those of deleted
+		// users.
+		if !transientFailures(responseBody, len(ids)) {
+			err = putCache(ctx, req, pagination, responseBody)
+			if err != nil {
+				return fmt.Errorf("unable to write user contribution data to cache: %v", err)
 			}
+		}
+	}
+
+	failures, err := nodeFailures(responseBody, len(ids))
+	if err != nil {
+		return err
+	}
 
-			// Update progress bar.
-			bar.IncrBy(contribPagination / (currentYear - untilYear))
+	err = parseYearlyContributions(responseBody, batch.years, failures, fetched)
+	if err != nil {
+		return err
+	}
+
+	retry := contributionBatch{
+		years:   batch.years,
+		retries: batch.retries + 1,
+	}
+	for idx, user := range batch.users {
+		gqlErr, failed := failures[idx]
+		if !failed {
+			continue
 		}
+
+		if gqlErr.retryable() && batch.retries < maxPartialRetries {
+			retry.users = append(retry.users, user)
+			continue
+		}
+
+		dropped.add(DroppedUser{ID: user.ID, Login: user.Login, Reason: gqlErr.reason()})
 	}
 
-	bar.Abort(true)
+	if len(retry.users) == 0 {
+		return nil
+	}
 
-	return users, nil
+	return fetchContributionBatch(cancelCtx, ctx, client, skipped, dropped, job, retry, fetched)
 }
 
-func buildRequestBody(ctx *context.Context, baseRequest string, pagination int) string {
-	// Inject constant values into request body.
-	requestBody := strings.Replace(baseRequest, "$repoOwner", ctx.RepoOwner, 1)
-	requestBody = strings.Replace(requestBody, "$repoName", ctx.RepoName, 1)
-	requestBody = strings.Replace(requestBody, "$pagination", fmt.Sprint(pagination), 1)
+// splitContributionBatch fetches the contributions of a batch of users for
+// which the GitHub API times out. Years are fetched separately first, since
+// lighter queries might not time out. When a single year still times out,
+// the users are split in two halves. When a single user remains, this user
+// is skipped.
+func splitContributionBatch(cancelCtx gocontext.Context, ctx *context.Context, client *client, skipped *skipList, dropped *droppedUsers, job contributionJob, batch contributionBatch, fetched map[string]map[int]contributions) error {
+	var halves []contributionBatch
+
+	switch {
+	case len(batch.years) > 1:
+		half := len(batch.years) / 2
+		halves = []contributionBatch{
+			{users: batch.users, years: batch.years[:half], retries: batch.retries},
+			{users: batch.users, years: batch.years[half:], retries: batch.retries},
+		}
+	case len(batch.users) > 1:
+		half := len(batch.users) / 2
+		halves = []contributionBatch{
+			{users: batch.users[:half], years: batch.years, retries: batch.retries},
+			{users: batch.users[half:], years: batch.years, retries: batch.retries},
+		}
+	default:
+		// The user responsible for the timeouts was isolated.
+		return skipped.add(ctx, skippedUser{
+			Login:      batch.users[0].Login,
+			Repository: repositoryName(ctx),
+			Page:       job.key,
+			Year:       batch.years[0],
+		})
+	}
 
-	// Remove all `\n` so that it's valid JSON. Remove all spaces.
-	requestBody = strings.Replace(requestBody, "\t", "", -1)
-	requestBody = strings.Replace(requestBody, " ", "", -1)
-	requestBody = strings.Replace(requestBody, "\n", " ", -1)
+	for _, half := range halves {
+		err := fetchContributionBatch(cancelCtx, ctx, client, skipped, dropped, job, half, fetched)
+		if err != nil {
+			return err
+		}
+	}
 
-	return requestBody
+	return nil
 }
 
-// Return the appropriate cursors to be used by the fetchContributions function
-// according to the value of ${contribPagination}. Also makes sure not to include
-// any page of users containing blacklisted individuals.
-func getCursors(ctx *context.Context, sg []stargazers, totalUsers uint) []string {
-	var (
-		skip      bool
-		iteration uint
-		cursors   []string
-	)
+// parseYearlyContributions parses the response to a contributions query,
+// and adds the contributions of each user during each of the given years
+// to the given contributions. Users whose node failed to be resolved
+// are left out, since their contributions might be incomplete.
+func parseYearlyContributions(responseBody []byte, years []int, failures map[int]gqlError, fetched map[string]map[int]contributions) error {
+	var aliased contributionsResponse
+	err := json.Unmarshal(responseBody, &aliased)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal user contributions: %v", err)
+	}
 
-	for _, stargazers := range sg {
-		var currentPageUsers int
+	for idx, node := range aliased.Data.Nodes {
+		if _, failed := failures[idx]; failed || node == nil {
+			continue
+		}
 
-		for _, user := range stargazers.Users {
-			if isBlacklisted(user.Login) {
-				skip = true
-			}
+		var login string
+		err = json.Unmarshal(node["login"], &login)
+		if err != nil {
+			return fmt.Errorf("unable to unmarshal user login: %v", err)
+		}
 
-			// If this is the last user of the whole set, even if it's exactly at the
-			// end of the current page, we don't need its cursor, because there is nothing
-			// to get after his profile.
-			if iteration == totalUsers-1 {
-				break
+		if fetched[login] == nil {
+			fetched[login] = make(map[int]contributions)
+		}
+
+		for _, year := range years {
+			collection, ok := node[yearAlias(year)]
+			if !ok {
+				continue
 			}
 
-			// Iterate through list of stargazers, and add a cursor for every
-			// ${contribPagination} users, unless one of the users within the current
-			// page is blacklisted, in which case we skip the whole page.
-			if iteration >= (contribPagination-1) && iteration%contribPagination == contribPagination-1 {
-				if !skip {
-					cursors = append(cursors, stargazers.Meta[currentPageUsers].Cursor)
-				} else {
-					skip = false
-				}
+			var yearContributions contributions
+			err = json.Unmarshal(collection, &yearContributions)
+			if err != nil {
+				return fmt.Errorf("unable to unmarshal contributions of year %d: %v", year, err)
 			}
 
-			iteration++
-			currentPageUsers++
+			fetched[login][year] = yearContributions
+		}
+	}
+
+	return nil
+}
+
+// pageResponses builds one response per year for a page of stargazers,
+// in which users have the contributions that were fetched for that year.
+// Users have no contributions during the years that were not fetched.
+func pageResponses(page *stargazers, fetched map[string]map[int]contributions, years []int) []*listStargazersResponse {
+	responses := make([]*listStargazersResponse, len(years))
+	for idx, year := range years {
+		var response listStargazersResponse
+		for _, user := range page.Users {
+			user.Contributions = fetched[user.Login][year]
+			response.Repository.Stargazers.Users = append(response.Repository.Stargazers.Users, user)
 		}
+
+		responses[idx] = &response
+	}
+
+	return responses
+}
+
+// workerCount returns the amount of workers to use to fetch contributions.
+func workerCount(ctx *context.Context) int {
+	if ctx.Workers == 0 {
+		return 1
 	}
 
+	return int(ctx.Workers)
+}
+
+// selectStargazers selects the stargazers for which to fetch contributions
+// among every stargazer of the repository, in the order in which they starred
+// it. The first stargazers are always selected, and the others are selected
+// individually at random, so that the sample does not depend on how the
+// stargazers are paginated. Selected stargazers have the stratum of the
+// stargazer timeline from which they were selected.
+func selectStargazers(ctx *context.Context, all []Stargazer, seed int64) []Stargazer {
+	totalUsers := len(all)
 	if totalUsers <= 219 {
 		disgo.Infof("All %d stargazers will be scanned\n", totalUsers)
-		return cursors
+		return all
 	}
 
-	var selectedCursors []string
+	// The first stargazers are not part of any stratum.
+	first := firstStargazers(ctx)
+	disgo.Infof("Selecting %d first stargazers out of %d\n", first, totalUsers)
+	selected := append([]Stargazer(nil), all[:first]...)
+	remaining := all[first:]
 
-	// totalCursorAmount is the total amount of cursors to fetch.
-	totalCursorAmount := int(ctx.Stars) / contribPagination
+	if ctx.ScanAll || uint(totalUsers) < ctx.Stars {
+		disgo.Infof("Selecting all %d remaining stargazers\n", len(remaining))
 
-	// beginCursorAmount is the amount of cursors to fetch for the 200 first users.
-	disgo.Infof("Selecting 200 first stargazers out of %d\n", totalUsers)
-	beginCursorAmount := 200/contribPagination - 1
+		strata := strataCount(ctx)
+		if strata > len(remaining) {
+			strata = len(remaining)
+		}
 
-	selectedCursors = append(selectedCursors, cursors[len(cursors)-beginCursorAmount-1:len(cursors)-1]...)
+		for idx, stargazer := range remaining {
+			stargazer.Stratum = stratumOf(idx, len(remaining), strata)
+			selected = append(selected, stargazer)
+		}
 
-	if ctx.ScanAll || totalUsers < ctx.Stars {
-		disgo.Infof("Selecting all %d remaining stargazers\n", totalUsers-200)
-		selectedCursors = append(selectedCursors, cursors[:len(cursors)-beginCursorAmount]...)
-	} else {
-		// endCursorAmount is the amount of cursors to fetch to get the random users.
-		endCursorAmount := totalCursorAmount - beginCursorAmount
-		disgo.Infof("Selecting %d random stargazers out of %d\n", (endCursorAmount-1)*contribPagination, totalUsers)
+		return selected
+	}
+
+	amount := int(ctx.Stars) - len(selected)
+	if amount == 0 {
+		return selected
+	}
 
-		selectedCursors = pickRandomStringsExcept(cursors, selectedCursors, uint(endCursorAmount))
+	disgo.Infof("Selecting %d random stargazers out of %d, from %d slices of the stargazer timeline\n", amount, totalUsers, strataCount(ctx))
+
+	picks, pickStrata := pickStratified(len(remaining), amount, strataCount(ctx), seed)
+	for idx, pick := range picks {
+		stargazer := remaining[pick]
+		stargazer.Stratum = pickStrata[idx]
+		selected = append(selected, stargazer)
 	}
 
-	return selectedCursors
+	return selected
 }
 
-// Pick random strings picks ${amount} random strings from the
-// given slice of strings, except those that were already picked.
-func pickRandomStringsExcept(s []string, picked []string, amount uint) []string {
-	// Make the random non-deterministic.
-	seed := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(seed)
-
-	for i := uint(1); i < amount; i++ {
-		// Pick a string.
-		newPick := s[random.Intn(len(s)-1)]
-
-		// Check if it has already been selected.
-		var found bool
-		for _, alreadyPicked := range picked {
-			if newPick == alreadyPicked {
-				found = true
+// strataCount returns the amount of strata in which the stargazer
+// timeline is split to select random stargazers.
+func strataCount(ctx *context.Context) int {
+	if ctx.Strata < 1 {
+		return 1
+	}
+
+	return int(ctx.Strata)
+}
+
+// pickStratified picks ${amount} random positions of an ordered list of
+// ${total} elements. The list is split in ${strata} equal-sized strata, and
+// the same amount of positions is picked from each stratum. It returns the
+// picked positions in ascending order, along with the stratum of each of
+// them, starting at 1. The same seed always results in the same picks.
+func pickStratified(total, amount, strata int, seed int64) ([]int, []int) {
+	if amount > total {
+		amount = total
+	}
+	if strata > amount {
+		strata = amount
+	}
+	if strata < 1 {
+		return nil, nil
+	}
+
+	random := rand.New(rand.NewSource(seed))
+
+	members := make([][]int, strata)
+	for idx := 0; idx < total; idx++ {
+		stratum := stratumOf(idx, total, strata) - 1
+		members[stratum] = append(members[stratum], idx)
+	}
+
+	// Each stratum gets the same amount of picks, and the remainder
+	// is spread over random strata.
+	quotas := make([]int, strata)
+	for stratum := range quotas {
+		quotas[stratum] = amount / strata
+	}
+	for _, stratum := range random.Perm(strata)[:amount%strata] {
+		quotas[stratum]++
+	}
+
+	var count int
+	selected := make([]bool, total)
+	for stratum, idxs := range members {
+		for _, member := range random.Perm(len(idxs)) {
+			if quotas[stratum] == 0 {
+				break
 			}
+
+			selected[idxs[member]] = true
+			quotas[stratum]--
+			count++
 		}
+	}
 
-		// Regenerate another one if this index has already been selected.
-		if found {
-			i--
-			continue
+	// Strata can be one element smaller than their quota, in which
+	// case the missing picks are taken from any stratum.
+	for _, idx := range random.Perm(total) {
+		if count == amount {
+			break
 		}
 
-		picked = append(picked, newPick)
+		if !selected[idx] {
+			selected[idx] = true
+			count++
+		}
 	}
 
-	return picked
-}
-
-// isBlacklisted checks if a user is blacklisted.
-func isBlacklisted(user string) bool {
-	for _, blacklistedUser := range blacklistedUsers {
-		if user == blacklistedUser {
-			return true
+	var picks, pickStrata []int
+	for idx := range selected {
+		if selected[idx] {
+			picks = append(picks, idx)
+			pickStrata = append(pickStrata, stratumOf(idx, total, strata))
 		}
 	}
 
-	return false
+	return picks, pickStrata
+}
+
+// stratumOf returns the stratum, starting at 1, of the element at the
+// given index of an ordered list of ${total} elements that is split in
+// ${strata} equal-sized strata.
+func stratumOf(idx, total, strata int) int {
+	return idx*strata/total + 1
 }
 
 // setupProgressBar sets the progress bar properly according to
-// the expected amount of pages of data.
-func setupProgressBar(pages int) (*mpb.Progress, *mpb.Bar) {
+// the expected amount of stargazers. It also shows when requests
+// are paused because every token of the given pool is rate limited.
+func setupProgressBar(users int, tokens *tokenPool) (*mpb.Progress, *mpb.Bar) {
 	p := mpb.New(mpb.WithWidth(64))
 
-	bar := p.AddBar(int64(pages*contribPagination),
+	bar := p.AddBar(int64(users),
 		mpb.BarRemoveOnComplete(),
 		mpb.AppendDecorators(
 			decor.Name("ETA: "),
@@ -477,57 +1083,57 @@ func setupProgressBar(pages int) (*mpb.Progress, *mpb.Bar) {
 			decor.Name(" Elapsed: "),
 			decor.Elapsed(decor.ET_STYLE_GO),
 			decor.Name(" Progress: "),
-			decor.Percentage()),
+			decor.Percentage(),
+			decor.Any(func(*decor.Statistics) string {
+				if status := tokens.status(); status != "" {
+					return " " + status
+				}
+				return ""
+			})),
 	)
 
 	return p, bar
 }
 
-// getCursor returns the current cursor for the given page, depending on the
-// order the cursors are being read in.
-func getCursor(cursors []string, page int, reverseOrder bool) string {
-	// If scanning in the reverse order, we don't have any page without
-	// a cursor, so we don't start using the cursor from page 2 but
-	// the first one directly.
-	if reverseOrder && page > 0 {
-		return cursors[page-1]
-	}
-
-	// If not scanning in the reverse order, the first page does not
-	// need a cursor since we can simply request the first X users.
-	if page > 1 {
-		return cursors[page-2]
-	}
-
-	return "firstpage"
-}
-
 // parseResponse parses a response from the GitHub API and converts it in the appropriate data model.
-// It also returns the response body if it was read successfully.
+// It also returns the response body if it was read successfully. Failed responses result in an
+// *APIError that describes the class of the failure. When only part of the data was resolved,
+// the response is returned along with the error.
 func parseResponse(resp *http.Response) (*listStargazersResponse, []byte, error) {
 	if resp == nil {
 		return nil, nil, errors.New("unable to parse nil response")
 	}
+	defer resp.Body.Close()
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		resp.Body.Close()
 		return nil, nil, fmt.Errorf("unable to read response body: %v", err)
 	}
 
+	// Cached responses don't have any status code.
+	if apiErr := statusError(resp.StatusCode, responseBody); apiErr != nil {
+		return nil, responseBody, apiErr
+	}
+
 	var response listStargazersResponse
 	err = json.Unmarshal(responseBody, &response)
 	if err != nil {
 		disgo.Errorf("Unable to parse body: %s\n", responseBody)
-		resp.Body.Close()
 		return nil, responseBody, fmt.Errorf("unable to unmarshal stargazers: %v", err)
 	}
 
 	if len(response.Errors) != 0 {
-		resp.Body.Close()
-		return nil, responseBody, fmt.Errorf("error while querying user data: %v [%s:%s]", response.Errors[0].Message, response.Errors[0].Extensions.ArgumentName, response.Errors[0].Extensions.Name)
+		apiErr := queryError(resp.StatusCode, responseBody, response.Errors)
+		if apiErr.Kind != PartialDataError {
+			return nil, responseBody, apiErr
+		}
+
+		response.Repository.Stargazers.setStarDates()
+		return &response, responseBody, apiErr
 	}
 
+	response.Repository.Stargazers.setStarDates()
+
 	return &response, responseBody, nil
 }
 
@@ -1,142 +1,72 @@
 package gql
 
 import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/Ullaakut/astronomer/pkg/context"
 )
 
-func TestBuildRequestBody(t *testing.T) {
+func TestSelectStargazers(t *testing.T) {
 	tests := map[string]struct {
-		baseRequest string
-		repoOwner   string
-		repoName    string
-		pagination  int
-
-		expectedBody string
-	}{
-		"fetch users request": {
-			baseRequest: fetchUsersRequest,
-			repoOwner:   "ullaakut",
-			repoName:    "cameradar",
-			pagination:  42,
-
-			expectedBody: `{"query":"{ rateLimit{ limit remaining } repository(owner:\"ullaakut\",name:\"cameradar\"){ stargazers(first:42){ edges{ cursor } nodes{ login } } } }"}`,
-		},
-		"fetch contributions request": {
-			baseRequest: fetchContributionsRequest,
-			repoOwner:   "ullaakut",
-			repoName:    "camerattack",
-			pagination:  84,
-
-			expectedBody: `{"query":"{ rateLimit{ remaining } repository(owner:\"ullaakut\",name:\"camerattack\"){ stargazers(first:84){ edges{ cursor } nodes{ login createdAt contributionsCollection(from:\"$dateFrom\",to:\"$dateTo\"){ restrictedContributionsCount totalIssueContributions totalCommitContributions totalRepositoryContributions totalPullRequestContributions totalPullRequestReviewContributions contributionCalendar{ totalContributions } } } } } }"}`,
-		},
-	}
-
-	for description, test := range tests {
-		t.Run(description, func(t *testing.T) {
-			ctx := &context.Context{
-				RepoOwner: test.repoOwner,
-				RepoName:  test.repoName,
-			}
-
-			requestBody := buildRequestBody(ctx, test.baseRequest, test.pagination)
-
-			assert.Equal(t, test.expectedBody, requestBody)
-		})
-	}
-}
-
-func TestGetCursors(t *testing.T) {
-	sg := stargazers{
-		Users: []User{{Login: "titi"}, {Login: "toto"}, {Login: "tete"}, {Login: "tata"}, {Login: "tutu"}},
-		Meta:  metaData{{Cursor: "titi"}, {Cursor: "toto"}, {Cursor: "tete"}, {Cursor: "tata"}, {Cursor: "tutu"}},
-	}
-
-	// blacklistedStargazers := stargazers{
-	// 	Users: []User{{Login: "jstrachan"}, {Login: "toto"}, {Login: "tete"}, {Login: "tata"}, {Login: "tutu"}},
-	// 	Meta:  metaData{{Cursor: "jstrachan"}, {Cursor: "toto"}, {Cursor: "tete"}, {Cursor: "tata"}, {Cursor: "tutu"}},
-	// }
-
-	tests := map[string]struct {
-		stargazers []stargazers
-		totalUsers uint
+		totalUsers int
 		starLimit  uint
 		scanAll    bool
 
-		expectedCursors []string
+		expectedUsers int
 	}{
 		"less users than pagination": {
-			stargazers: []stargazers{
-				sg,
-			},
 			totalUsers: 5,
 			starLimit:  100,
 
-			expectedCursors: nil,
+			expectedUsers: 5,
 		},
-		"exactly as many users as pagination": {
-			stargazers: []stargazers{
-				sg, sg, sg, sg,
-			},
-			totalUsers: 20,
+		"less users than the first stargazers": {
+			totalUsers: 219,
 			starLimit:  100,
 
-			expectedCursors: nil,
+			expectedUsers: 219,
 		},
-		"more users than pagination": {
-			stargazers: []stargazers{
-				sg, sg, sg, sg,
-				sg, sg, sg,
-			},
-			totalUsers: 35,
+		"more users than the star limit": {
+			totalUsers: 1000,
+			starLimit:  300,
+
+			expectedUsers: 300,
+		},
+		"star limit below the first stargazers": {
+			totalUsers: 1000,
 			starLimit:  100,
 
-			expectedCursors: []string{"tutu"},
+			expectedUsers: 100,
 		},
-		"way more users than pagination": {
-			stargazers: []stargazers{
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-			},
-			totalUsers: 160,
-			starLimit:  200,
+		"less users than the star limit": {
+			totalUsers: 250,
+			starLimit:  300,
 
-			expectedCursors: []string{"tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu"},
+			expectedUsers: 250,
 		},
 		"scan all stars should return all stars": {
-			stargazers: []stargazers{
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-				sg, sg, sg, sg, sg, sg, sg, sg,
-			},
-			totalUsers: 400,
+			totalUsers: 1000,
+			starLimit:  300,
 			scanAll:    true,
 
-			expectedCursors: []string{"tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu", "tutu"},
+			expectedUsers: 1000,
 		},
-		// "blacklisted stargazers should dcause page skips": {
-		// 	stargazers: []stargazers{
-		// 		sg, sg, sg, sg, sg, sg, blacklistedStargazers, sg,
-		// 		sg, sg, sg, sg, sg, sg, sg, sg,
-		// 		sg, sg, sg, sg, sg, sg, sg, sg,
-		// 		sg, sg, sg, sg, sg, sg, sg, sg,
-		// 	},
-		// 	totalUsers: 160,
-		// 	starLimit:  200,
-
-		// 	expectedCursors: []string{"tutu", "tutu", "tutu", "tutu", "tutu", "tutu"},
-		// },
 	}
 
 	for description, test := range tests {
@@ -144,11 +74,30 @@ func TestGetCursors(t *testing.T) {
 			ctx := &context.Context{
 				ScanAll: test.scanAll,
 				Stars:   test.starLimit,
+				Strata:  5,
 			}
 
-			cursors := getCursors(ctx, test.stargazers, test.totalUsers)
+			all := fakeSample(test.totalUsers)
+			positions := make(map[string]int)
+			for idx, stargazer := range all {
+				positions[stargazer.ID] = idx
+			}
+
+			sample := selectStargazers(ctx, all, 42)
+			require.Len(t, sample, test.expectedUsers)
+
+			// Stargazers are selected individually, in the order in which
+			// they starred the repository, starting with the first ones.
+			for idx, stargazer := range sample {
+				if idx < 200 || test.totalUsers <= 219 {
+					assert.Equal(t, idx, positions[stargazer.ID])
+					assert.Zero(t, stargazer.Stratum)
+					continue
+				}
 
-			assert.Equal(t, test.expectedCursors, cursors)
+				assert.True(t, positions[stargazer.ID] > positions[sample[idx-1].ID])
+				assert.True(t, stargazer.Stratum >= 1 && stargazer.Stratum <= 5)
+			}
 		})
 	}
 }
@@ -280,3 +229,420 @@ func TestUpdateUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchStargazersCustomEndpoint(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		assert.Equal(t, "Bearer fakeToken", r.Header.Get("Authorization"))
+
+		fmt.Fprint(w, `{"data":{"rateLimit":{"limit":5000,"remaining":4999},"repository":{"stargazers":{
+			"totalCount":3,
+			"edges":[{"cursor":"titi"},{"cursor":"toto"},{"cursor":"tete"}],
+			"nodes":[{"id":"id-titi","login":"titi"},{"id":"id-toto","login":"toto"},{"id":"id-tete","login":"tete"}]
+		}}}}`)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		GithubTokens:       []string{"fakeToken"},
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              100,
+	}
+
+	sample, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+
+	// The latest stargazers are fetched first, to count the stargazers.
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, uint(3), totalUsers)
+	assert.Equal(t, []Stargazer{{ID: "id-titi"}, {ID: "id-toto"}, {ID: "id-tete"}}, sample)
+
+	// The cache entry must be derived from the configured endpoint.
+	req, err := http.NewRequest("POST", server.URL, nil)
+	require.NoError(t, err)
+
+	_, err = os.Stat(cacheEntryFilename(ctx, req.URL.String()+listFilePagination("")))
+	assert.NoError(t, err)
+}
+
+func TestParseResponseStarDates(t *testing.T) {
+	resp := &http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(`{"data":{"repository":{"stargazers":{
+			"edges":[{"cursor":"titi","starredAt":"2019-06-01T12:00:00Z"},{"cursor":"toto","starredAt":"2019-06-02T12:00:00Z"}],
+			"nodes":[{"login":"titi"},{"login":"toto"}]
+		}}}}`)),
+	}
+
+	response, _, err := parseResponse(resp)
+	require.NoError(t, err)
+
+	assert.True(t, response.Repository.Stargazers.hasStarDates())
+	assert.Equal(t, []User{
+		{Login: "titi", StarredAt: "2019-06-01T12:00:00Z"},
+		{Login: "toto", StarredAt: "2019-06-02T12:00:00Z"},
+	}, response.Repository.Stargazers.Users)
+}
+
+func TestFetchContributionsConcurrent(t *testing.T) {
+	currentYear := time.Now().Year()
+
+	var contributionRequests int32
+	server := fakeStargazers(t, 60, func(w http.ResponseWriter, request graphQLRequest) bool {
+		if _, ok := request.Variables["ids"]; ok && !isProfilesQuery(request) {
+			atomic.AddInt32(&contributionRequests, 1)
+		}
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              100,
+		Workers:            4,
+	}
+
+	sample := fakeSample(60)
+	users, _, err := FetchContributions(gocontext.Background(), ctx, sample, currentYear-1)
+	require.NoError(t, err)
+	require.Len(t, users, 60)
+
+	for idx := range users {
+		assert.Equal(t, fmt.Sprintf("u%d", idx), users[idx].Login)
+		assert.Equal(t, "2019-06-01T12:00:00Z", users[idx].StarredAt)
+		assert.Equal(t, map[int]int{currentYear: 2, currentYear - 1: 1}, users[idx].YearlyContributions)
+	}
+
+	// Contributions of every year are fetched at once for each page.
+	assert.Equal(t, int32(3), atomic.LoadInt32(&contributionRequests))
+
+	// The progress of the scan must have been persisted.
+	plan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, plan)
+
+	assert.Equal(t, currentYear-1, plan.UntilYear)
+	pages := samplePages(sample)
+	assert.ElementsMatch(t, []string{pageKey(pages[0]), pageKey(pages[1]), pageKey(pages[2])}, plan.Completed)
+}
+
+func TestFetchContributionsInterrupted(t *testing.T) {
+	currentYear := time.Now().Year()
+	cancelCtx, cancel := gocontext.WithCancel(gocontext.Background())
+	defer cancel()
+
+	server := fakeStargazers(t, 60, func(w http.ResponseWriter, request graphQLRequest) bool {
+		// Interrupt the scan while fetching the last page.
+		ids, _ := request.Variables["ids"].([]interface{})
+		if len(ids) > 0 && ids[0] == "id-u40" {
+			cancel()
+			return false
+		}
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              100,
+		Workers:            1,
+	}
+
+	sample := fakeSample(60)
+	users, _, err := FetchContributions(cancelCtx, ctx, sample, currentYear-1)
+	assert.Equal(t, gocontext.Canceled, err)
+
+	// Only the pages that were entirely fetched are returned.
+	require.Len(t, users, 40)
+	assert.Equal(t, "u0", users[0].Login)
+	assert.Equal(t, "u39", users[39].Login)
+
+	plan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	pages := samplePages(sample)
+	assert.ElementsMatch(t, []string{pageKey(pages[0]), pageKey(pages[1])}, plan.Completed)
+}
+
+func TestPlanBatch(t *testing.T) {
+	years := []int{2019, 2018, 2017, 2016}
+
+	veteran := User{ID: "1", Login: "veteran", CreatedAt: "2010-01-01T00:00:00Z", Contributions: contributions{ContributionYears: []int{2019, 2015, 2010}}}
+	newcomer := User{ID: "2", Login: "newcomer", CreatedAt: "2018-03-01T00:00:00Z", Contributions: contributions{ContributionYears: []int{2019, 2018}}}
+	retired := User{ID: "3", Login: "retired", CreatedAt: "2010-01-01T00:00:00Z", Contributions: contributions{ContributionYears: []int{2017, 2012}}}
+	inactive := User{ID: "4", Login: "inactive", CreatedAt: "2010-01-01T00:00:00Z"}
+	skipped := User{ID: "5", Login: "skipped", CreatedAt: "2010-01-01T00:00:00Z", Contributions: contributions{ContributionYears: []int{2019}}}
+	veteran2 := User{ID: "6", Login: "veteran2", CreatedAt: "2012-01-01T00:00:00Z", Contributions: contributions{ContributionYears: []int{2019, 2012}}}
+
+	skippedUsers := &skipList{Users: []skippedUser{{Login: "skipped", Year: 2019}}}
+
+	tests := map[string]struct {
+		users []User
+
+		expectedBatch contributionBatch
+	}{
+		"every active year of the page": {
+			users: []User{veteran, newcomer, retired, inactive, skipped, veteran2},
+
+			expectedBatch: contributionBatch{
+				users: []User{veteran, newcomer, retired, veteran2},
+				years: []int{2019, 2018, 2017, 2016},
+			},
+		},
+		"recent users": {
+			users: []User{newcomer, inactive},
+
+			expectedBatch: contributionBatch{
+				users: []User{newcomer},
+				years: []int{2019, 2018},
+			},
+		},
+		"range of active years": {
+			users: []User{retired, newcomer},
+
+			expectedBatch: contributionBatch{
+				users: []User{retired, newcomer},
+				years: []int{2019, 2018, 2017, 2016},
+			},
+		},
+		"no active users": {
+			users: []User{inactive, skipped},
+
+			expectedBatch: contributionBatch{},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedBatch, planBatch(test.users, years, skippedUsers))
+		})
+	}
+}
+
+func TestPageResponses(t *testing.T) {
+	body := []byte(`{"data":{"nodes":[
+		{"login":"titi","y2019":{"totalCommitContributions":3,"contributionCalendar":{"totalContributions":5}},"y2018":{"restrictedContributionsCount":1}},
+		{"login":"toto","y2019":{"totalIssueContributions":2,"contributionCalendar":{"totalContributions":7}}}
+	]}}`)
+
+	fetched := make(map[string]map[int]contributions)
+	require.NoError(t, parseYearlyContributions(body, []int{2019, 2018}, nil, fetched))
+
+	page := &stargazers{
+		Users: []User{
+			{Login: "titi", StarredAt: "2019-06-01T12:00:00Z"},
+			{Login: "toto", StarredAt: "2019-06-02T12:00:00Z"},
+			{Login: "tata", StarredAt: "2019-06-03T12:00:00Z"},
+		},
+	}
+
+	var users []User
+	for idx, response := range pageResponses(page, fetched, []int{2019, 2018}) {
+		users = updateUsers(users, *response, []int{2019, 2018}[idx])
+	}
+
+	require.Len(t, users, 3)
+	assert.Equal(t, "titi", users[0].Login)
+	assert.Equal(t, map[int]int{2019: 5, 2018: 1}, users[0].YearlyContributions)
+	assert.Equal(t, 3, users[0].Contributions.TotalCommitContributions)
+	assert.Equal(t, 1, users[0].Contributions.PrivateContributions)
+	assert.Equal(t, "toto", users[1].Login)
+	assert.Equal(t, map[int]int{2019: 7, 2018: 0}, users[1].YearlyContributions)
+	assert.Equal(t, 2, users[1].Contributions.TotalIssueContributions)
+	assert.Equal(t, "2019-06-02T12:00:00Z", users[1].StarredAt)
+
+	// Users without contributions still have a contribution count for every year.
+	assert.Equal(t, "tata", users[2].Login)
+	assert.Equal(t, map[int]int{2019: 0, 2018: 0}, users[2].YearlyContributions)
+}
+
+// fakeStargazers serves the queries and REST requests used to list the given
+// amount of stargazers and to fetch their contributions. Stargazers are named
+// after their index, which is also their cursor, and their ID is their login
+// prefixed with "id-". They contributed every year since 2013, once per year and
+// twice during the current year. The hook is called for every GraphQL
+// request, which is only answered if the hook returns true.
+func fakeStargazers(t *testing.T, amount int, hook func(w http.ResponseWriter, request graphQLRequest) bool) *httptest.Server {
+	currentYear := time.Now().Year()
+
+	var logins []string
+	for idx := 0; idx < amount; idx++ {
+		logins = append(logins, fmt.Sprintf("u%d", idx))
+	}
+
+	avatars := make(map[bool][]byte)
+	for _, identicon := range []bool{true, false} {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, fakeAvatar(identicon)))
+		avatars[identicon] = buf.Bytes()
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Users with an even index kept the default avatar.
+		if strings.HasPrefix(r.URL.Path, "/avatars/") {
+			var idx int
+			_, err := fmt.Sscanf(r.URL.Path, "/avatars/u%d", &idx)
+			require.NoError(t, err)
+
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(avatars[idx%2 == 0])
+			return
+		}
+
+		// Page of stargazers of the REST API.
+		if r.URL.Path == "/v3/repos/ullaakut/astronomer/stargazers" {
+			var page, perPage int
+			_, err := fmt.Sscanf(r.URL.Query().Get("page")+" "+r.URL.Query().Get("per_page"), "%d %d", &page, &perPage)
+			require.NoError(t, err)
+
+			start, end := (page-1)*perPage, page*perPage
+			if end > len(logins) {
+				end = len(logins)
+			}
+
+			var stargazers []string
+			for _, login := range logins[start:end] {
+				stargazers = append(stargazers, fmt.Sprintf(`{"starred_at":"2019-06-01T12:00:00Z","user":{"login":%q,"node_id":"id-%s"}}`, login, login))
+			}
+
+			fmt.Fprintf(w, "[%s]", strings.Join(stargazers, ","))
+			return
+		}
+
+		var request graphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		if !hook(w, request) {
+			return
+		}
+
+		var edges, nodes []string
+
+		// Profiles of a batch of users.
+		if isProfilesQuery(request) {
+			for _, id := range request.Variables["ids"].([]interface{}) {
+				login := strings.TrimPrefix(id.(string), "id-")
+				nodes = append(nodes, fmt.Sprintf(`{"id":%q,"login":%q,"createdAt":"2012-01-01T00:00:00Z","bio":"Hi","avatarUrl":"http://%s/avatars/%s","followers":{"totalCount":3},"following":{"totalCount":4},"repositories":{"totalCount":5},"starredRepositories":{"totalCount":6},"contributionsCollection":{"contributionYears":[%d,2013]}}`, id, login, r.Host, login, currentYear))
+			}
+
+			fmt.Fprintf(w, `{"data":{"rateLimit":{"remaining":4999},"nodes":[%s]}}`, strings.Join(nodes, ","))
+			return
+		}
+
+		// Contributions of a batch of users.
+		if ids, ok := request.Variables["ids"]; ok {
+			for _, id := range ids.([]interface{}) {
+				fields := []string{fmt.Sprintf(`"login":%q`, strings.TrimPrefix(id.(string), "id-"))}
+				for variable := range request.Variables {
+					var year int
+					if _, err := fmt.Sscanf(variable, "from%d", &year); err != nil {
+						continue
+					}
+
+					contributions := 1
+					if year == currentYear {
+						contributions = 2
+					}
+
+					fields = append(fields, fmt.Sprintf(`%q:{"contributionCalendar":{"totalContributions":%d}}`, yearAlias(year), contributions))
+				}
+
+				nodes = append(nodes, fmt.Sprintf("{%s}", strings.Join(fields, ",")))
+			}
+
+			fmt.Fprintf(w, `{"data":{"rateLimit":{"remaining":4999},"nodes":[%s]}}`, strings.Join(nodes, ","))
+			return
+		}
+
+		// Page of stargazers, after the one whose login is the cursor, or
+		// before it when listing the latest stargazers.
+		pagination := int(request.Variables["pagination"].(float64))
+		start, end := 0, len(logins)
+		for idx, login := range logins {
+			if login == request.Variables["cursor"] {
+				start, end = idx+1, idx
+			}
+		}
+
+		if request.Query == fetchLatestUsersQuery {
+			start = end - pagination
+			if start < 0 {
+				start = 0
+			}
+		} else {
+			end = start + pagination
+			if end > len(logins) {
+				end = len(logins)
+			}
+		}
+
+		for _, login := range logins[start:end] {
+			edges = append(edges, fmt.Sprintf(`{"cursor":%q,"starredAt":"2019-06-01T12:00:00Z"}`, login))
+			nodes = append(nodes, fmt.Sprintf(`{"id":"id-%s","login":%q}`, login, login))
+		}
+
+		fmt.Fprintf(w, `{"data":{"rateLimit":{"remaining":4999},"repository":{"stargazers":{"totalCount":%d,"edges":[%s],"nodes":[%s]}}}}`, len(logins), strings.Join(edges, ","), strings.Join(nodes, ","))
+	}))
+}
+
+// isProfilesQuery returns whether or not a request fetches the profiles
+// of a batch of users.
+func isProfilesQuery(request graphQLRequest) bool {
+	return request.Query == planContributionsQuery
+}
+
+// fakeSample returns a sample of the given amount of the stargazers
+// served by fakeStargazers, in the order in which they starred the
+// repository.
+func fakeSample(amount int) []Stargazer {
+	var sample []Stargazer
+	for idx := 0; idx < amount; idx++ {
+		sample = append(sample, Stargazer{
+			ID:        fmt.Sprintf("id-u%d", idx),
+			StarredAt: "2019-06-01T12:00:00Z",
+		})
+	}
+
+	return sample
+}
+
+// fakeAvatar generates an avatar, which is either a default identicon
+// or a custom picture.
+func fakeAvatar(identicon bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 42, 42))
+	for y := 0; y < 42; y++ {
+		for x := 0; x < 42; x++ {
+			switch {
+			case !identicon:
+				img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+			case x/7%2 == y/7%2:
+				img.Set(x, y, color.RGBA{R: 136, G: 82, B: 204, A: 255})
+			default:
+				img.Set(x, y, identiconBackground)
+			}
+		}
+	}
+
+	return img
+}
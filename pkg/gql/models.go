@@ -1,6 +1,9 @@
 package gql
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Ullaakut/disgo"
@@ -16,66 +19,245 @@ const (
 	// ISO8601 time format used by the GitHub API.
 	iso8601Format = "2006-01-02T15:04:05Z"
 
-	// Request to list users. Low cost in terms of rate limiting.
-	fetchUsersRequest = `{"query" : "{
-			rateLimit {
-				limit
-				remaining
+	// Query to list users. Low cost in terms of rate limiting.
+	fetchUsersQuery = `query($repoOwner: String!, $repoName: String!, $pagination: Int!, $cursor: String) {
+	rateLimit {
+		limit
+		cost
+		remaining
+		resetAt
+	}
+	repository(owner: $repoOwner, name: $repoName) {
+		stargazers(first: $pagination, after: $cursor) {
+			edges {
+				cursor
+				starredAt
 			}
-			repository(owner: \"$repoOwner\", name: \"$repoName\") {
-				stargazers(first: $pagination) {
-					edges {
-						cursor
-					}
-					nodes {
-						login
-					}
-				}
+			nodes {
+				id
+				login
 			}
-		}"}`
+		}
+	}
+}`
 
-	// Request to fetch user contributions. Expensive in terms of rate limiting.
-	// Fetching more than 20 users at a time is pretty much a guaranteed timeout.
-	fetchContributionsRequest = `{"query" : "{
-			rateLimit {
-				remaining
+	// Query to check the remaining rate limit budget of a token, and
+	// that the repository exists. Low cost in terms of rate limiting.
+	preflightQuery = `query($repoOwner: String!, $repoName: String!) {
+	rateLimit {
+		limit
+		cost
+		remaining
+		resetAt
+	}
+	repository(owner: $repoOwner, name: $repoName) {
+		stargazers {
+			totalCount
+		}
+	}
+}`
+
+	// Query to list the latest stargazers, before a cursor, along with the
+	// total amount of stargazers. Low cost in terms of rate limiting.
+	fetchLatestUsersQuery = `query($repoOwner: String!, $repoName: String!, $pagination: Int!, $cursor: String) {
+	rateLimit {
+		limit
+		cost
+		remaining
+		resetAt
+	}
+	repository(owner: $repoOwner, name: $repoName) {
+		stargazers(last: $pagination, before: $cursor) {
+			totalCount
+			edges {
+				cursor
+				starredAt
 			}
-			repository(owner: \"$repoOwner\", name: \"$repoName\") {
-				stargazers(first: $pagination) {
-					edges {
-						cursor
-					}
-					nodes {
-						login
-						createdAt
-						contributionsCollection(from: \"$dateFrom\", to: \"$dateTo\") {
-							restrictedContributionsCount
-							totalIssueContributions
-							totalCommitContributions
-							totalRepositoryContributions
-							totalPullRequestContributions
-							totalPullRequestReviewContributions
-							contributionCalendar {
-								totalContributions
-							}
-						}
-					}
-				}
+			nodes {
+				id
+				login
+			}
+		}
+	}
+}`
+
+	// Query to fetch the profiles of a batch of users along with the years
+	// during which they contributed, in order to plan which contributions
+	// to fetch. Low cost in terms of rate limiting.
+	planContributionsQuery = `query($ids: [ID!]!) {
+	rateLimit {
+		limit
+		cost
+		remaining
+		resetAt
+	}
+	nodes(ids: $ids) {
+		... on User {
+			id
+			login
+			createdAt
+			bio
+			company
+			location
+			websiteUrl
+			avatarUrl
+			followers {
+				totalCount
+			}
+			following {
+				totalCount
+			}
+			repositories(ownerAffiliations: OWNER) {
+				totalCount
+			}
+			starredRepositories {
+				totalCount
+			}
+			contributionsCollection {
+				contributionYears
 			}
-		}"}`
+		}
+	}
+}`
+
+	// Query to fetch user contributions. Expensive in terms of rate limiting.
+	// Fetching more than 20 users at a time is pretty much a guaranteed timeout.
+	// The contributions of each year are fetched by an aliased collection.
+	fetchContributionsQuery = `query($ids: [ID!]!, %s) {
+	rateLimit {
+		limit
+		cost
+		remaining
+		resetAt
+	}
+	nodes(ids: $ids) {
+		... on User {
+			login
+%s
+		}
+	}
+}`
+
+	// Collection of the contributions of a user during one year.
+	contributionsCollectionQuery = `			%s: contributionsCollection(from: $from%d, to: $to%d) {
+				restrictedContributionsCount
+				totalIssueContributions
+				totalCommitContributions
+				totalRepositoryContributions
+				totalPullRequestContributions
+				totalPullRequestReviewContributions
+				contributionCalendar {
+					totalContributions
+				}
+			}`
 )
 
+// contributionsQuery builds the query to fetch the contributions of
+// a batch of users during each of the given years.
+func contributionsQuery(years []int) string {
+	var (
+		variables   []string
+		collections []string
+	)
+
+	for _, year := range years {
+		variables = append(variables, fmt.Sprintf("$from%d: DateTime!, $to%d: DateTime!", year, year))
+		collections = append(collections, fmt.Sprintf(contributionsCollectionQuery, yearAlias(year), year, year))
+	}
+
+	return fmt.Sprintf(fetchContributionsQuery, strings.Join(variables, ", "), strings.Join(collections, "\n"))
+}
+
+// yearAlias returns the alias of the contributions collection of a year.
+func yearAlias(year int) string {
+	return fmt.Sprintf("y%d", year)
+}
+
+// Stargazer is a stargazer selected to be scanned.
+type Stargazer struct {
+	// ID is the node ID of the user.
+	ID string `json:"id"`
+
+	// StarredAt is the date at which the user starred the repository.
+	StarredAt string `json:"starredAt"`
+
+	// Stratum is the slice of the stargazer timeline from which the
+	// stargazer was randomly selected, starting at 1. It is 0 for
+	// stargazers that were not selected from any stratum, such as
+	// the first stargazers.
+	Stratum int `json:"stratum,omitempty"`
+}
+
 // User represents a github user who starred a repository. It is
 // public because this model is the output of the Fetch methods of
 // this package.
 type User struct {
+	ID            string        `json:"id"`
 	Login         string        `json:"login"`
 	CreatedAt     string        `json:"createdAt"`
 	Contributions contributions `json:"contributionsCollection"`
 
+	// StarredAt is the date at which the user starred the repository.
+	StarredAt string `json:"starredAt"`
+
+	// Profile of the user. Bot accounts rarely fill them in, follow or
+	// are followed by anyone, or own repositories.
+	Bio                 string     `json:"bio"`
+	Company             string     `json:"company"`
+	Location            string     `json:"location"`
+	WebsiteURL          string     `json:"websiteUrl"`
+	AvatarURL           string     `json:"avatarUrl"`
+	Followers           totalCount `json:"followers"`
+	Following           totalCount `json:"following"`
+	Repositories        totalCount `json:"repositories"`
+	StarredRepositories totalCount `json:"starredRepositories"`
+
+	// HasDefaultAvatar is true if the user kept the identicon
+	// generated by GitHub as their avatar.
+	HasDefaultAvatar bool `json:"hasDefaultAvatar"`
+
+	// Stratum is the slice of the stargazer timeline from which the user
+	// was randomly selected, starting at 1. It is 0 for users who were
+	// not selected from any stratum, such as the first stargazers.
+	Stratum int `json:"stratum"`
+
 	YearlyContributions map[int]int
 }
 
+// activeYears returns the years, among the given ones, during which the
+// user could have contributed: from the first year during which they
+// contributed, or the year they created their account, to the last year
+// during which they contributed.
+func (u User) activeYears(years []int) []int {
+	contributionYears := u.Contributions.ContributionYears
+	if len(contributionYears) == 0 {
+		return nil
+	}
+
+	first, last := contributionYears[0], contributionYears[0]
+	for _, year := range contributionYears {
+		if year < first {
+			first = year
+		}
+		if year > last {
+			last = year
+		}
+	}
+
+	if creationDate, err := time.Parse(iso8601Format, u.CreatedAt); err == nil && creationDate.Year() > first {
+		first = creationDate.Year()
+	}
+
+	var active []int
+	for _, year := range years {
+		if year >= first && year <= last {
+			active = append(active, year)
+		}
+	}
+
+	return active
+}
+
 // DaysOld returns the amount of days since this user created their
 // GitHub account.
 func (u User) DaysOld() float64 {
@@ -94,7 +276,24 @@ type listStargazersResponse struct {
 	Errors       []gqlError `json:"errors"`
 }
 
+// usersResponse is the response to a query that fetches users by ID.
+type usersResponse struct {
+	Data struct {
+		Nodes []User `json:"nodes"`
+	} `json:"data"`
+}
+
+// contributionsResponse is the response to a contributions query, in
+// which the contributions of each year are aliased.
+type contributionsResponse struct {
+	Data struct {
+		Nodes []map[string]json.RawMessage `json:"nodes"`
+	} `json:"data"`
+}
+
 type gqlError struct {
+	Type       string            `json:"type"`
+	Path       []interface{}     `json:"path"`
 	Extensions gqlErrorExtension `json:"extensions"`
 	Message    string            `json:"message"`
 }
@@ -106,7 +305,7 @@ type gqlErrorExtension struct {
 
 type response struct {
 	Repository repository `json:"repository"`
-	RateLimit  rateLimit  `json:"ratelimit"`
+	RateLimit  rateLimit  `json:"rateLimit"`
 }
 
 type rateLimit struct {
@@ -121,8 +320,9 @@ type repository struct {
 }
 
 type stargazers struct {
-	Users []User   `json:"nodes"`
-	Meta  metaData `json:"edges"`
+	TotalCount int      `json:"totalCount"`
+	Users      []User   `json:"nodes"`
+	Meta       metaData `json:"edges"`
 }
 
 type metaData []meta
@@ -140,7 +340,43 @@ func (m metaData) cursor() string {
 }
 
 type meta struct {
-	Cursor string `json:"cursor"`
+	Cursor    string `json:"cursor"`
+	StarredAt string `json:"starredAt"`
+}
+
+// setStarDates sets the date at which each user starred the repository,
+// from the edges of the stargazers connection.
+func (s *stargazers) setStarDates() {
+	for idx := range s.Users {
+		if idx < len(s.Meta) {
+			s.Users[idx].StarredAt = s.Meta[idx].StarredAt
+		}
+	}
+}
+
+// hasStarDates returns whether or not the star dates of the stargazers
+// are known. They are not in responses cached by older versions of
+// astronomer.
+func (s stargazers) hasStarDates() bool {
+	for _, m := range s.Meta {
+		if m.StarredAt == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasIDs returns whether or not the node IDs of the stargazers are known.
+// They are not in responses cached by older versions of astronomer.
+func (s stargazers) hasIDs() bool {
+	for _, user := range s.Users {
+		if user.ID == "" {
+			return false
+		}
+	}
+
+	return true
 }
 
 type contributions struct {
@@ -152,6 +388,15 @@ type contributions struct {
 	TotalPullRequestReviewContributions int `json:"totalPullRequestReviewContributions"`
 
 	ContributionCalendar contributionCalendar `json:"contributionCalendar"`
+
+	// ContributionYears are the years during which the user contributed,
+	// the most recent year first.
+	ContributionYears []int `json:"contributionYears"`
+}
+
+// totalCount is the size of a connection, such as the followers of a user.
+type totalCount struct {
+	TotalCount int `json:"totalCount"`
 }
 
 type contributionCalendar struct {
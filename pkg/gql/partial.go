@@ -0,0 +1,159 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Ullaakut/disgo"
+)
+
+// maxPartialRetries is the amount of times the users that could not be
+// resolved in a partial response are fetched again before being dropped.
+const maxPartialRetries = 2
+
+// DroppedUser is a sampled stargazer that was left out of the scan, because
+// the GitHub API could not resolve all of its data.
+type DroppedUser struct {
+	ID string
+
+	// Login is empty when the profile of the user could not be fetched.
+	Login string
+
+	// Reason is the reason why the data of the user could not be fetched.
+	Reason string
+}
+
+// droppedUsers contains the users dropped during a scan. It can be
+// updated concurrently by the workers that fetch contributions.
+type droppedUsers struct {
+	mu sync.Mutex
+
+	users []DroppedUser
+}
+
+// add drops a user for the given reason.
+func (d *droppedUsers) add(user DroppedUser) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	disgo.Debugf("Dropping user %s %s: %s\n", user.ID, user.Login, user.Reason)
+	d.users = append(d.users, user)
+}
+
+// list returns the dropped users, sorted by ID since workers
+// drop them in any order.
+func (d *droppedUsers) list() []DroppedUser {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	users := append([]DroppedUser(nil), d.users...)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users
+}
+
+// filter removes dropped users from the given list of users. Like skipped
+// users, their contributions are only known for some of the years.
+func (d *droppedUsers) filter(users []User) []User {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dropped := make(map[string]bool)
+	for _, user := range d.users {
+		dropped[user.ID] = true
+	}
+
+	var filtered []User
+	for _, user := range users {
+		if !dropped[user.ID] {
+			filtered = append(filtered, user)
+		}
+	}
+
+	return filtered
+}
+
+// nodeFailures returns the errors of a response to a query that fetches the
+// given amount of nodes by ID, by index of the node that could not be
+// resolved. Errors that don't concern a single node concern all of them.
+func nodeFailures(responseBody []byte, nodes int) (map[int]gqlError, error) {
+	var response struct {
+		Errors []gqlError `json:"errors"`
+	}
+	err := json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal errors: %v", err)
+	}
+
+	failures := make(map[int]gqlError)
+	for _, gqlErr := range response.Errors {
+		idx, ok := gqlErr.nodeIndex()
+		if !ok || idx >= nodes {
+			for idx := 0; idx < nodes; idx++ {
+				failures[idx] = gqlErr
+			}
+			continue
+		}
+
+		failures[idx] = gqlErr
+	}
+
+	return failures, nil
+}
+
+// transientFailures returns whether or not some of the given amount of nodes
+// could not be resolved in a response for a reason that might not last. Such
+// responses are not cached, so that later scans fetch those nodes again
+// instead of dropping them for good.
+func transientFailures(responseBody []byte, nodes int) bool {
+	failures, err := nodeFailures(responseBody, nodes)
+	if err != nil {
+		return true
+	}
+
+	for _, gqlErr := range failures {
+		if gqlErr.retryable() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nodeIndex returns the index of the node that could not be resolved,
+// according to the path of the error, such as ["nodes", 3, "y2019"].
+func (e gqlError) nodeIndex() (int, bool) {
+	if len(e.Path) < 2 || e.Path[0] != "nodes" {
+		return 0, false
+	}
+
+	// JSON numbers are decoded as floats.
+	idx, ok := e.Path[1].(float64)
+	if !ok || idx < 0 {
+		return 0, false
+	}
+
+	return int(idx), true
+}
+
+// retryable returns whether or not the node that could not be resolved
+// because of this error might be resolved by fetching it again. Nodes
+// that don't exist, such as deleted users, never will.
+func (e gqlError) retryable() bool {
+	return e.Type != "NOT_FOUND"
+}
+
+// reason returns a short description of the error, which is the same
+// for every node that failed for the same reason.
+func (e gqlError) reason() string {
+	if e.Type != "" {
+		return strings.ToLower(strings.Replace(e.Type, "_", " ", -1))
+	}
+
+	return e.Message
+}
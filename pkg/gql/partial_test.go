@@ -0,0 +1,245 @@
+package gql
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestNodeFailures(t *testing.T) {
+	tests := map[string]struct {
+		body  string
+		nodes int
+
+		expectedFailures map[int]string
+	}{
+		"no errors": {
+			body:  `{"data":{"nodes":[{"login":"titi"}]}}`,
+			nodes: 1,
+
+			expectedFailures: map[int]string{},
+		},
+		"node errors": {
+			body:  `{"data":{"nodes":[null,{"login":"toto","y2019":null},{"login":"tata"}]},"errors":[{"type":"NOT_FOUND","path":["nodes",0]},{"path":["nodes",1,"y2019"],"message":"timeout"}]}`,
+			nodes: 3,
+
+			expectedFailures: map[int]string{
+				0: "not found",
+				1: "timeout",
+			},
+		},
+		"query errors": {
+			body:  `{"data":{"nodes":[{"login":"titi"},{"login":"toto"}]},"errors":[{"path":["rateLimit"],"message":"Something went wrong"}]}`,
+			nodes: 2,
+
+			expectedFailures: map[int]string{
+				0: "Something went wrong",
+				1: "Something went wrong",
+			},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			failures, err := nodeFailures([]byte(test.body), test.nodes)
+			require.NoError(t, err)
+
+			reasons := make(map[int]string)
+			for idx, gqlErr := range failures {
+				reasons[idx] = gqlErr.reason()
+			}
+
+			assert.Equal(t, test.expectedFailures, reasons)
+		})
+	}
+}
+
+func TestFetchContributionsPartialData(t *testing.T) {
+	currentYear := time.Now().Year()
+
+	stargazers := fakeStargazers(t, 4, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer stargazers.Close()
+
+	var (
+		mu        sync.Mutex
+		requested [][]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			stargazers.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var request graphQLRequest
+		require.NoError(t, json.Unmarshal(body, &request))
+
+		recorder := httptest.NewRecorder()
+		stargazers.Config.Handler.ServeHTTP(recorder, r)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+		ids := request.Variables["ids"].([]interface{})
+		nodes := response["data"].(map[string]interface{})["nodes"].([]interface{})
+
+		var errs []interface{}
+		for idx, id := range ids {
+			switch {
+			// The account of u3 was deleted.
+			case id == "id-u3":
+				nodes[idx] = nil
+				errs = append(errs, map[string]interface{}{
+					"type":    "NOT_FOUND",
+					"path":    []interface{}{"nodes", idx},
+					"message": "Could not resolve to a node with the global id of 'id-u3'",
+				})
+
+			// The contributions of u1 time out, unless they are fetched on their own.
+			case id == "id-u1" && !isProfilesQuery(request) && len(ids) > 1:
+				nodes[idx] = map[string]interface{}{"login": "u1", yearAlias(currentYear): nil}
+				errs = append(errs, map[string]interface{}{
+					"path":    []interface{}{"nodes", idx, yearAlias(currentYear)},
+					"message": "Something went wrong while executing your query. This may be the result of a timeout, or it could be a GitHub bug.",
+				})
+			}
+		}
+
+		if len(errs) != 0 {
+			response["errors"] = errs
+		}
+
+		mu.Lock()
+		requested = append(requested, ids)
+		mu.Unlock()
+
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              20,
+	}
+
+	for i := 0; i < 2; i++ {
+		users, dropped, err := FetchContributions(gocontext.Background(), ctx, fakeSample(4), currentYear-1)
+		require.NoError(t, err)
+		require.Len(t, users, 3)
+
+		// The users that resolved are kept, in the order of the sample.
+		for idx, login := range []string{"u0", "u1", "u2"} {
+			assert.Equal(t, login, users[idx].Login)
+			assert.Equal(t, map[int]int{currentYear: 2, currentYear - 1: 1}, users[idx].YearlyContributions)
+		}
+
+		assert.Equal(t, []DroppedUser{{ID: "id-u3", Reason: "not found"}}, dropped)
+	}
+
+	// Only the contributions of u1 are fetched again. The second scan reads
+	// the profiles from the cache, since u3 will never be found, but fetches
+	// the contributions again, since those of u1 might resolve this time.
+	assert.Equal(t, [][]interface{}{
+		{"id-u0", "id-u1", "id-u2", "id-u3"},
+		{"id-u0", "id-u1", "id-u2"},
+		{"id-u1"},
+		{"id-u0", "id-u1", "id-u2"},
+	}, requested)
+}
+
+func TestFetchContributionsDropsUnresolvedUsers(t *testing.T) {
+	currentYear := time.Now().Year()
+
+	var (
+		mu        sync.Mutex
+		attempts  int
+		recovered bool
+	)
+	server := fakeStargazers(t, 2, func(w http.ResponseWriter, request graphQLRequest) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if isProfilesQuery(request) || recovered {
+			return true
+		}
+
+		ids := request.Variables["ids"].([]interface{})
+		if ids[len(ids)-1] != "id-u1" {
+			return true
+		}
+
+		attempts++
+
+		// The contributions of u1 never resolve.
+		body := `{"data":{"nodes":[{"login":"u1","y%[1]d":null}]},"errors":[{"path":["nodes",0,"y%[1]d"],"message":"Something went wrong"}]}`
+		if len(ids) > 1 {
+			body = `{"data":{"nodes":[{"login":"u0","y%[1]d":{"contributionCalendar":{"totalContributions":2}}},{"login":"u1","y%[1]d":null}]},"errors":[{"path":["nodes",1,"y%[1]d"],"message":"Something went wrong"}]}`
+		}
+
+		fmt.Fprintf(w, body, currentYear)
+		return false
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              20,
+	}
+
+	users, dropped, err := FetchContributions(gocontext.Background(), ctx, fakeSample(2), currentYear)
+	require.NoError(t, err)
+
+	require.Len(t, users, 1)
+	assert.Equal(t, "u0", users[0].Login)
+	assert.Equal(t, map[int]int{currentYear: 2}, users[0].YearlyContributions)
+
+	assert.Equal(t, []DroppedUser{{ID: "id-u1", Login: "u1", Reason: "Something went wrong"}}, dropped)
+	assert.Equal(t, 1+maxPartialRetries, attempts)
+
+	// Once the GitHub API recovers, scanning again with the same cache
+	// resolves the contributions of u1.
+	mu.Lock()
+	recovered = true
+	mu.Unlock()
+
+	users, dropped, err = FetchContributions(gocontext.Background(), ctx, fakeSample(2), currentYear)
+	require.NoError(t, err)
+
+	require.Len(t, users, 2)
+	for idx, login := range []string{"u0", "u1"} {
+		assert.Equal(t, login, users[idx].Login)
+		assert.Equal(t, map[int]int{currentYear: 2}, users[idx].YearlyContributions)
+	}
+	assert.Empty(t, dropped)
+}
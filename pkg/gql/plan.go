@@ -0,0 +1,122 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+// scanPlanFilename is the name of the file in which the plan of the last
+// scan of a repository is stored, in the repository's cache directory.
+const scanPlanFilename = "scanplan.json"
+
+// scanPlan contains everything needed to resume an interrupted scan with
+// the exact same sample of stargazers. It is persisted in the cache
+// directory of the scanned repository.
+type scanPlan struct {
+	mu sync.Mutex
+
+	// Parameters of the scan that influence the selected sample.
+	Stars   uint  `json:"stars"`
+	ScanAll bool  `json:"scanAll"`
+	Seed    int64 `json:"seed"`
+
+	// Stargazers selected for this scan, in the order in which their
+	// contributions are fetched.
+	Stargazers []Stargazer `json:"stargazers"`
+	TotalUsers uint        `json:"totalUsers"`
+
+	// LastCursor is the cursor of the last stargazer of the repository
+	// at the time of the scan, after which to list new stargazers when
+	// updating the scan.
+	LastCursor string `json:"lastCursor,omitempty"`
+
+	// UntilYear is the year until which contributions are fetched.
+	// It is set once contributions start being fetched.
+	UntilYear int `json:"untilYear,omitempty"`
+
+	// Completed contains the keys of the pages for which contributions
+	// were fetched for every year.
+	Completed []string `json:"completed,omitempty"`
+}
+
+// scanPlanPath returns the path of the scan plan of the scanned repository.
+func scanPlanPath(ctx *context.Context) string {
+	return filepath.Join(ctx.CacheDirectoryPath, ctx.RepoOwner, ctx.RepoName, scanPlanFilename)
+}
+
+// loadScanPlan loads the plan of the last scan of the repository. It
+// returns nil if no scan plan was found.
+func loadScanPlan(ctx *context.Context) (*scanPlan, error) {
+	data, err := ioutil.ReadFile(scanPlanPath(ctx))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read scan plan: %v", err)
+	}
+
+	var plan scanPlan
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse scan plan: %v", err)
+	}
+
+	return &plan, nil
+}
+
+// save writes the scan plan in the cache directory.
+func (p *scanPlan) save(ctx *context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal scan plan: %v", err)
+	}
+
+	err = writeFileAtomic(scanPlanPath(ctx), data)
+	if err != nil {
+		return fmt.Errorf("unable to write scan plan: %v", err)
+	}
+
+	return nil
+}
+
+// markCompleted records that the page with the given key was
+// entirely fetched.
+func (p *scanPlan) markCompleted(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Pages completed by an interrupted scan are completed again
+	// when resuming it, from the cache.
+	for _, completed := range p.Completed {
+		if completed == key {
+			return
+		}
+	}
+
+	p.Completed = append(p.Completed, key)
+}
+
+// matches returns whether or not the plan was made for the given sample
+// of stargazers.
+func (p *scanPlan) matches(sample []Stargazer) bool {
+	if len(p.Stargazers) != len(sample) {
+		return false
+	}
+
+	for idx := range sample {
+		if p.Stargazers[idx].ID != sample[idx].ID {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,465 @@
+package gql
+
+import (
+	gocontext "context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestScanPlan(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+	}
+
+	plan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, plan)
+
+	plan = &scanPlan{
+		Stars:      1000,
+		Seed:       42,
+		Stargazers: []Stargazer{{ID: "titi"}, {ID: "toto", Stratum: 1}},
+		TotalUsers: 4242,
+		UntilYear:  2013,
+	}
+
+	plan.markCompleted("titi")
+	plan.markCompleted("titi")
+	require.NoError(t, plan.save(ctx))
+
+	loadedPlan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, loadedPlan)
+
+	assert.Equal(t, uint(1000), loadedPlan.Stars)
+	assert.Equal(t, int64(42), loadedPlan.Seed)
+	assert.Equal(t, uint(4242), loadedPlan.TotalUsers)
+	assert.Equal(t, 2013, loadedPlan.UntilYear)
+	assert.Equal(t, []string{"titi"}, loadedPlan.Completed)
+	assert.Equal(t, 1, loadedPlan.Stargazers[1].Stratum)
+	assert.True(t, loadedPlan.matches([]Stargazer{{ID: "titi"}, {ID: "toto"}}))
+	assert.False(t, loadedPlan.matches([]Stargazer{{ID: "toto"}, {ID: "titi"}}))
+}
+
+func TestFetchStargazersResume(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("resumed scans should not list stargazers again")
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              100,
+		Resume:             true,
+	}
+
+	plan := &scanPlan{
+		Stars:      1000,
+		ScanAll:    true,
+		Seed:       42,
+		Stargazers: []Stargazer{{ID: "titi"}, {ID: "toto"}},
+		TotalUsers: 4242,
+	}
+	require.NoError(t, plan.save(ctx))
+
+	sample, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Stargazer{{ID: "titi"}, {ID: "toto"}}, sample)
+	assert.Equal(t, uint(4242), totalUsers)
+	assert.Equal(t, uint(1000), ctx.Stars)
+	assert.True(t, ctx.ScanAll)
+	assert.Equal(t, int64(42), ctx.Seed)
+}
+
+func TestFetchStargazersSeed(t *testing.T) {
+	server := fakeStargazers(t, 1000, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	newContext := func(seed int64) *context.Context {
+		return &context.Context{
+			RepoOwner:          "ullaakut",
+			RepoName:           "astronomer",
+			CacheDirectoryPath: cacheDir,
+			GraphQLEndpoint:    server.URL,
+			Stars:              400,
+			Seed:               seed,
+		}
+	}
+
+	ctx := newContext(0)
+	randomSample, _, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+	assert.NotZero(t, ctx.Seed)
+
+	// Scanning again with the seed of a scan selects the same stargazers.
+	sample, _, err := FetchStargazers(gocontext.Background(), newContext(ctx.Seed))
+	require.NoError(t, err)
+	assert.Equal(t, randomSample, sample)
+
+	ctx = newContext(7)
+	first, _, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), ctx.Seed)
+
+	second, _, err := FetchStargazers(gocontext.Background(), newContext(7))
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	plan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), plan.Seed)
+}
+
+func TestPickStratifiedIsDeterministic(t *testing.T) {
+	first, firstStrata := pickStratified(10, 4, 2, 42)
+	second, secondStrata := pickStratified(10, 4, 2, 42)
+
+	assert.Len(t, first, 4)
+	assert.Equal(t, first, second)
+	assert.Equal(t, firstStrata, secondStrata)
+}
+
+func TestPickStratified(t *testing.T) {
+	tests := map[string]struct {
+		amount int
+		strata int
+
+		expectedPicks []int
+	}{
+		"even strata": {
+			amount: 20,
+			strata: 5,
+
+			expectedPicks: []int{4, 4, 4, 4, 4},
+		},
+		"uneven strata": {
+			amount: 7,
+			strata: 3,
+
+			expectedPicks: []int{2, 2, 2},
+		},
+		"single stratum": {
+			amount: 10,
+			strata: 1,
+
+			expectedPicks: []int{10},
+		},
+		"more strata than picks": {
+			amount: 3,
+			strata: 10,
+
+			expectedPicks: []int{1, 1, 1},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			picks, strata := pickStratified(98, test.amount, test.strata, 42)
+			require.Len(t, picks, test.amount)
+			require.Len(t, strata, test.amount)
+
+			// Each stratum is a contiguous slice of the positions.
+			picksPerStratum := make([]int, len(test.expectedPicks))
+			for idx, pick := range picks {
+				if idx > 0 {
+					assert.True(t, pick > picks[idx-1])
+				}
+
+				assert.Equal(t, stratumOf(pick, 98, len(test.expectedPicks)), strata[idx])
+				picksPerStratum[strata[idx]-1]++
+			}
+
+			// The remainder of uneven strata is spread over random strata.
+			for stratum, expected := range test.expectedPicks {
+				assert.True(t, picksPerStratum[stratum] >= expected, "stratum %d has %d picks", stratum+1, picksPerStratum[stratum])
+			}
+		})
+	}
+}
+
+func TestFetchContributionsStrata(t *testing.T) {
+	server := fakeStargazers(t, 1000, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              400,
+		Strata:             4,
+		Seed:               42,
+		Workers:            4,
+	}
+
+	sample, _, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+
+	users, _, err := FetchContributions(gocontext.Background(), ctx, sample, time.Now().Year())
+	require.NoError(t, err)
+	require.Len(t, users, 400)
+
+	// The first stargazers are not part of any stratum, and the random
+	// stargazers are selected from every stratum.
+	usersPerStratum := make(map[int]int)
+	for idx, user := range users {
+		if idx < 200 {
+			assert.Zero(t, user.Stratum)
+			continue
+		}
+
+		usersPerStratum[user.Stratum]++
+	}
+
+	assert.Len(t, usersPerStratum, 4)
+	for stratum := 1; stratum <= 4; stratum++ {
+		assert.True(t, usersPerStratum[stratum] >= 40, "stratum %d has %d users", stratum, usersPerStratum[stratum])
+	}
+}
+
+func TestFetchStargazersRefetchesLastPage(t *testing.T) {
+	var cursors []interface{}
+	server := fakeStargazers(t, 150, func(w http.ResponseWriter, request graphQLRequest) bool {
+		if request.Query == fetchUsersQuery {
+			cursors = append(cursors, request.Variables["cursor"])
+		}
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              100,
+	}
+
+	_, _, err = FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, "u99"}, cursors)
+
+	// Full pages are read from the cache, but the last page might have
+	// new stargazers.
+	cursors = nil
+	_, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"u99"}, cursors)
+	assert.Equal(t, uint(150), totalUsers)
+}
+
+func TestSelectNewStargazers(t *testing.T) {
+	var newStargazers []Stargazer
+	for idx := 0; idx < 100; idx++ {
+		newStargazers = append(newStargazers, Stargazer{ID: fmt.Sprintf("id-u%d", 1000+idx)})
+	}
+
+	tests := map[string]struct {
+		plan *scanPlan
+
+		expectedAmount  int
+		expectedStratum int
+	}{
+		"every stargazer scanned": {
+			plan: &scanPlan{
+				ScanAll:    true,
+				Stargazers: fakeSampleStrata(200, 800, 5),
+				TotalUsers: 1000,
+			},
+
+			expectedAmount:  100,
+			expectedStratum: 5,
+		},
+		"sample of stargazers": {
+			plan: &scanPlan{
+				Stars:      400,
+				Seed:       7,
+				Stargazers: fakeSampleStrata(200, 200, 4),
+				TotalUsers: 1000,
+			},
+
+			expectedAmount:  25,
+			expectedStratum: 4,
+		},
+		"sample of first stargazers only": {
+			plan: &scanPlan{
+				Stars:      100,
+				Stargazers: fakeSampleStrata(100, 0, 1),
+				TotalUsers: 1000,
+			},
+
+			expectedAmount: 0,
+		},
+		"first stargazers only": {
+			plan: &scanPlan{
+				Stars:      1000,
+				Stargazers: fakeSampleStrata(150, 0, 1),
+				TotalUsers: 150,
+			},
+
+			expectedAmount:  100,
+			expectedStratum: 1,
+		},
+		"every stargazer of a repository without slices": {
+			plan: &scanPlan{
+				Stars:      1000,
+				Stargazers: fakeSampleStrata(210, 0, 1),
+				TotalUsers: 210,
+			},
+
+			expectedAmount:  100,
+			expectedStratum: 1,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			ctx := &context.Context{
+				Stars:   test.plan.Stars,
+				ScanAll: test.plan.ScanAll,
+			}
+
+			selected := selectNewStargazers(ctx, test.plan, newStargazers)
+			require.Len(t, selected, test.expectedAmount)
+
+			for _, stargazer := range selected {
+				assert.Equal(t, test.expectedStratum, stargazer.Stratum)
+			}
+
+			// The same scan always selects the same new stargazers.
+			assert.Equal(t, selected, selectNewStargazers(ctx, test.plan, newStargazers))
+		})
+	}
+}
+
+// fakeSampleStrata returns a sample made of the given amount of first
+// stargazers, followed by the given amount of random stargazers spread
+// over the given amount of strata.
+func fakeSampleStrata(first, random, strata int) []Stargazer {
+	var sample []Stargazer
+	for idx := 0; idx < first; idx++ {
+		sample = append(sample, Stargazer{ID: fmt.Sprintf("id-u%d", idx)})
+	}
+
+	for idx := 0; idx < random; idx++ {
+		sample = append(sample, Stargazer{
+			ID:      fmt.Sprintf("id-u%d", first+idx),
+			Stratum: stratumOf(idx, random, strata),
+		})
+	}
+
+	return sample
+}
+
+func TestFetchStargazersIncremental(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	server := fakeStargazers(t, 1000, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer server.Close()
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              400,
+		Strata:             4,
+		Seed:               7,
+	}
+
+	previousSample, _, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+	require.Len(t, previousSample, 400)
+
+	// The repository received 30 new stars since the previous scan.
+	var cursors []interface{}
+	updatedServer := fakeStargazers(t, 1030, func(w http.ResponseWriter, request graphQLRequest) bool {
+		cursors = append(cursors, request.Variables["cursor"])
+		return true
+	})
+	defer updatedServer.Close()
+
+	ctx = &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    updatedServer.URL,
+		Stars:              100,
+		Incremental:        true,
+	}
+
+	sample, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+	require.NoError(t, err)
+
+	// Only the stargazers after the last known one are listed.
+	assert.Equal(t, []interface{}{"u999"}, cursors)
+	assert.Equal(t, uint(1030), totalUsers)
+	assert.Equal(t, uint(400), ctx.Stars)
+	assert.Equal(t, int64(7), ctx.Seed)
+
+	// New stargazers are added to the previous sample at the rate at which
+	// it selected random stargazers, 200 out of 800, in the latest slice of
+	// the stargazer timeline.
+	require.Len(t, sample, 408)
+	assert.Equal(t, previousSample, sample[:400])
+
+	var previousID int
+	for _, stargazer := range sample[400:] {
+		var id int
+		_, err := fmt.Sscanf(stargazer.ID, "id-u%d", &id)
+		require.NoError(t, err)
+
+		assert.True(t, id >= 1000 && id < 1030)
+		assert.True(t, id > previousID)
+		assert.Equal(t, 4, stargazer.Stratum)
+		previousID = id
+	}
+
+	plan, err := loadScanPlan(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "u1029", plan.LastCursor)
+	assert.True(t, plan.matches(sample))
+}
@@ -0,0 +1,331 @@
+package gql
+
+import (
+	gocontext "context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/cenkalti/backoff/v3"
+)
+
+const (
+	// requiredScope is the OAuth scope that personal access tokens
+	// need to read private repositories and contributions.
+	requiredScope = "repo"
+
+	// Approximate durations of requests, used to estimate how long
+	// a scan takes. Contributions take longer to resolve for each
+	// year that is fetched.
+	listRequestDuration      = time.Second
+	profilesRequestDuration  = 2 * time.Second
+	contributionYearDuration = time.Second
+
+	// The rate limit budget of each token is restored every hour.
+	rateLimitWindow = time.Hour
+)
+
+// Preflight is the result of the checks that are run before a scan.
+type Preflight struct {
+	// Stargazers is the total amount of stargazers of the repository.
+	Stargazers int
+
+	// Tokens contains the status of each token used by the scan.
+	Tokens []TokenStatus
+}
+
+// TokenStatus is the status of a token used by a scan.
+type TokenStatus struct {
+	// Name identifies the token without revealing it.
+	Name string
+
+	// Scopes are the OAuth scopes of the token. They are nil when
+	// unknown, since only personal access tokens have scopes.
+	Scopes []string
+
+	// Limit and Remaining are the rate limit budget of the token, in
+	// points, and ResetAt is the time at which it is restored.
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// MissingScope returns the OAuth scope that the token lacks to read private
+// repositories and contributions, or an empty string if it has it or if its
+// scopes are unknown.
+func (s TokenStatus) MissingScope() string {
+	if s.Scopes == nil {
+		return ""
+	}
+
+	for _, scope := range s.Scopes {
+		if scope == requiredScope {
+			return ""
+		}
+	}
+
+	return requiredScope
+}
+
+// RunPreflight checks that every token of the scan is valid, reads their
+// scopes and remaining rate limit budget, and makes sure that the repository
+// exists, before committing to a scan that can take hours.
+func RunPreflight(cancelCtx gocontext.Context, ctx *context.Context) (*Preflight, error) {
+	client, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := client.newRequest(preflightQuery, map[string]interface{}{
+		"repoOwner": ctx.RepoOwner,
+		"repoName":  ctx.RepoName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare request: %v", err)
+	}
+
+	var (
+		preflight Preflight
+		checked   bool
+	)
+	for idx, t := range client.tokens.tokens {
+		status := TokenStatus{Name: fmt.Sprintf("token %d", idx+1)}
+		if t.app != nil {
+			status.Name = "GitHub App installation"
+		}
+
+		stargazers, err := checkToken(cancelCtx, client, t, req, &status)
+		if err != nil {
+			return nil, wrapError(err, fmt.Errorf("preflight check of %s failed: %v", status.Name, err))
+		}
+
+		// Rate limited tokens can't check the repository.
+		if stargazers >= 0 {
+			preflight.Stargazers = stargazers
+			checked = true
+		}
+
+		preflight.Tokens = append(preflight.Tokens, status)
+	}
+
+	if !checked {
+		return nil, &APIError{
+			Kind:    RateLimitedError,
+			Message: "unable to check the repository: every token is rate limited",
+		}
+	}
+
+	return &preflight, nil
+}
+
+// checkToken sends the preflight query with the given token until the GitHub
+// API answers it, and sets the scopes and rate limit budget of the given
+// status accordingly. Like queries, failed attempts are retried depending on
+// the class of their error. It returns the amount of stargazers of the
+// repository, or -1 if the token is rate limited.
+func checkToken(cancelCtx gocontext.Context, client *client, t *token, req *http.Request, status *TokenStatus) (int, error) {
+	var (
+		stargazers int
+		attempts   int
+	)
+
+	err := backoff.Retry(func() error {
+		attempts++
+
+		var err error
+		stargazers, err = checkTokenOnce(cancelCtx, client, t, req, status)
+		if err != nil {
+			return giveUpAfter(attempts, err)
+		}
+
+		return nil
+	}, backoff.WithContext(backoff.NewConstantBackOff(retryInterval), cancelCtx))
+	if err != nil {
+		return 0, err
+	}
+
+	return stargazers, nil
+}
+
+// checkTokenOnce sends the preflight query once with the given token. See
+// checkToken.
+func checkTokenOnce(cancelCtx gocontext.Context, client *client, t *token, req *http.Request, status *TokenStatus) (int, error) {
+	credentials, err := t.credentials(cancelCtx)
+	if err != nil {
+		return 0, err
+	}
+
+	if credentials != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credentials))
+	}
+
+	resp, err := client.do(cancelCtx, req)
+	if err != nil {
+		return 0, fmt.Errorf("unable to send request: %v", err)
+	}
+
+	status.Scopes = oauthScopes(resp.Header)
+
+	// An exhausted budget is not an error, since the scan waits for it.
+	// GraphQL queries that exceed the budget of their token are answered
+	// successfully, with a RATE_LIMITED error.
+	var response *listStargazersResponse
+	if _, limited := secondaryRateLimit(resp); limited {
+		resp.Body.Close()
+	} else {
+		response, _, err = parseResponse(resp)
+		if err != nil && KindOf(err) != RateLimitedError {
+			return 0, err
+		}
+	}
+
+	if response == nil {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			status.ResetAt = time.Unix(reset, 0)
+		}
+		return -1, nil
+	}
+
+	status.Limit = response.RateLimit.Limit
+	status.Remaining = response.RateLimit.Remaining
+	status.ResetAt, _ = time.Parse(iso8601Format, response.RateLimit.ResetAt)
+
+	return response.Repository.Stargazers.TotalCount, nil
+}
+
+// oauthScopes returns the OAuth scopes listed in the headers of a response,
+// or nil if the token that authorized the request doesn't have scopes.
+func oauthScopes(header http.Header) []string {
+	if _, ok := header["X-Oauth-Scopes"]; !ok {
+		return nil
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Split(header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// Estimate is the estimated cost of a scan. Requests that are retried
+// because of partial responses or timeouts come on top of it, while
+// cached responses are free.
+type Estimate struct {
+	// Stargazers is the amount of stargazers whose contributions are
+	// fetched, and Years the amount of years of contributions.
+	Stargazers int
+	Years      int
+
+	// Queries is the amount of GraphQL queries, and RESTRequests the
+	// amount of requests to the REST API, which has its own budget.
+	Queries      int
+	RESTRequests int
+
+	// AvatarDownloads is the amount of avatars downloaded to check
+	// whether stargazers kept their default avatar.
+	AvatarDownloads int
+
+	// Cost is the rate limit cost of the queries, in points. Each
+	// query costs at least one point.
+	Cost int
+
+	// Duration is the time that the scan takes, including waiting for
+	// the rate limit budget of the tokens to be restored.
+	Duration time.Duration
+}
+
+// EstimateScan estimates the cost of a scan of the repository checked by
+// the given preflight, according to the options of the given context.
+func EstimateScan(ctx *context.Context, preflight *Preflight) Estimate {
+	total := preflight.Stargazers
+	population := populationOf(ctx, total)
+
+	estimate := Estimate{
+		Stargazers: population,
+		Years:      time.Now().Year() - ctx.SinceYear + 1,
+	}
+
+	// Listing starts with the latest stargazers.
+	listQueries := 1
+	if isSampled(ctx, population) {
+		estimate.Stargazers = int(ctx.Stars)
+
+		// Stargazers are fetched from the pages of the REST API, and
+		// the ones beyond its last page are found by walking cursors.
+		restPages := pageCount(total, restPagination)
+		if restPages > restPageLimit {
+			listQueries += pageCount(total-restPageLimit*restPagination, listPagination)
+			restPages = restPageLimit
+		}
+
+		estimate.RESTRequests = restPages
+		if estimate.RESTRequests > estimate.Stargazers {
+			estimate.RESTRequests = estimate.Stargazers
+		}
+	} else {
+		listQueries += pageCount(total, listPagination)
+	}
+
+	// The profiles and then the contributions of each page of stargazers
+	// are fetched concurrently by the workers, in one query each.
+	pages := pageCount(estimate.Stargazers, contribPagination)
+	estimate.Queries = listQueries + 2*pages
+	estimate.Cost = estimate.Queries
+	estimate.AvatarDownloads = estimate.Stargazers
+
+	listDuration := time.Duration(listQueries+estimate.RESTRequests) * listRequestDuration
+	pageDuration := profilesRequestDuration + time.Duration(estimate.Years)*contributionYearDuration
+	estimate.Duration = listDuration + time.Duration(pageCount(pages, workerCount(ctx)))*pageDuration
+
+	estimate.Duration += rateLimitWait(preflight.Tokens, estimate.Cost)
+
+	return estimate
+}
+
+// rateLimitWait returns how long a scan of the given cost waits for the rate
+// limit budget of the given tokens to be restored.
+func rateLimitWait(tokens []TokenStatus, cost int) time.Duration {
+	var (
+		remaining int
+		limit     int
+		resetAt   time.Time
+	)
+	for _, t := range tokens {
+		remaining += t.Remaining
+		limit += t.Limit
+
+		if !t.ResetAt.IsZero() && (resetAt.IsZero() || t.ResetAt.Before(resetAt)) {
+			resetAt = t.ResetAt
+		}
+	}
+
+	if cost <= remaining || resetAt.IsZero() {
+		return 0
+	}
+
+	wait := time.Until(resetAt)
+	if wait < 0 {
+		wait = 0
+	}
+
+	// Rate limited tokens don't report their limit.
+	if limit == 0 {
+		return wait
+	}
+
+	windows := pageCount(cost-remaining, limit)
+	return wait + time.Duration(windows-1)*rateLimitWindow
+}
+
+// pageCount returns the amount of pages of the given size that
+// are needed to hold the given amount of elements.
+func pageCount(amount, pageSize int) int {
+	return int(math.Ceil(float64(amount) / float64(pageSize)))
+}
@@ -0,0 +1,357 @@
+package gql
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestRunPreflight(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+
+	resetAt := time.Date(2019, 6, 1, 13, 0, 0, 0, time.UTC)
+
+	valid := func(w http.ResponseWriter) {
+		fmt.Fprint(w, `{"data":{"rateLimit":{"limit":5000,"cost":1,"remaining":4321,"resetAt":"2019-06-01T13:00:00Z"},"repository":{"stargazers":{"totalCount":1234}}}}`)
+	}
+
+	rateLimited := func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+		w.WriteHeader(http.StatusForbidden)
+	}
+
+	exhausted := func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(resetAt.Unix()))
+		fmt.Fprint(w, `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded for user ID 1."}]}`)
+	}
+
+	var serverErrors int
+	unstable := func(w http.ResponseWriter) {
+		if serverErrors < 2 {
+			serverErrors++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		valid(w)
+	}
+
+	tests := map[string]struct {
+		handlers map[string]func(w http.ResponseWriter)
+
+		expectedPreflight *Preflight
+		expectedKind      ErrorKind
+	}{
+		"valid tokens": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": func(w http.ResponseWriter) {
+					w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+					valid(w)
+				},
+				"Bearer fakeToken2": func(w http.ResponseWriter) {
+					w.Header().Set("X-OAuth-Scopes", "")
+					valid(w)
+				},
+			},
+
+			expectedPreflight: &Preflight{
+				Stargazers: 1234,
+				Tokens: []TokenStatus{
+					{Name: "token 1", Scopes: []string{"repo", "read:org"}, Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+					{Name: "token 2", Scopes: []string{}, Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+				},
+			},
+		},
+		"rate limited token": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": rateLimited,
+				"Bearer fakeToken2": valid,
+			},
+
+			expectedPreflight: &Preflight{
+				Stargazers: 1234,
+				Tokens: []TokenStatus{
+					{Name: "token 1", ResetAt: resetAt},
+					{Name: "token 2", Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+				},
+			},
+		},
+		"exhausted token": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": valid,
+				"Bearer fakeToken2": exhausted,
+			},
+
+			expectedPreflight: &Preflight{
+				Stargazers: 1234,
+				Tokens: []TokenStatus{
+					{Name: "token 1", Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+					{Name: "token 2", ResetAt: resetAt},
+				},
+			},
+		},
+		"transient server errors": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": unstable,
+				"Bearer fakeToken2": valid,
+			},
+
+			expectedPreflight: &Preflight{
+				Stargazers: 1234,
+				Tokens: []TokenStatus{
+					{Name: "token 1", Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+					{Name: "token 2", Limit: 5000, Remaining: 4321, ResetAt: resetAt},
+				},
+			},
+		},
+		"every token rate limited": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": rateLimited,
+				"Bearer fakeToken2": rateLimited,
+			},
+
+			expectedKind: RateLimitedError,
+		},
+		"bad credentials": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": valid,
+				"Bearer fakeToken2": func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, `{"message":"Bad credentials"}`)
+				},
+			},
+
+			expectedKind: AuthError,
+		},
+		"repository not found": {
+			handlers: map[string]func(w http.ResponseWriter){
+				"Bearer fakeToken1": func(w http.ResponseWriter) {
+					fmt.Fprint(w, `{"data":{"rateLimit":{"limit":5000,"cost":1,"remaining":4321,"resetAt":"2019-06-01T13:00:00Z"},"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],"message":"Could not resolve to a Repository with the name 'ullaakut/astronomr'."}]}`)
+				},
+			},
+
+			expectedKind: NotFoundError,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler, ok := test.handlers[r.Header.Get("Authorization")]
+				require.True(t, ok)
+
+				handler(w)
+			}))
+			defer server.Close()
+
+			preflight, err := RunPreflight(gocontext.Background(), &context.Context{
+				RepoOwner:       "ullaakut",
+				RepoName:        "astronomer",
+				GraphQLEndpoint: server.URL,
+				GithubTokens:    []string{"fakeToken1", "fakeToken2"},
+			})
+
+			if test.expectedPreflight == nil {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedKind, KindOf(err))
+				return
+			}
+
+			require.NoError(t, err)
+			for idx := range preflight.Tokens {
+				preflight.Tokens[idx].ResetAt = preflight.Tokens[idx].ResetAt.UTC()
+			}
+			assert.Equal(t, test.expectedPreflight, preflight)
+		})
+	}
+}
+
+func TestMissingScope(t *testing.T) {
+	tests := map[string]struct {
+		scopes []string
+
+		expectedScope string
+	}{
+		"unknown scopes": {
+			scopes: nil,
+
+			expectedScope: "",
+		},
+		"repo scope": {
+			scopes: []string{"read:org", "repo"},
+
+			expectedScope: "",
+		},
+		"no scopes": {
+			scopes: []string{},
+
+			expectedScope: "repo",
+		},
+		"public scope only": {
+			scopes: []string{"public_repo"},
+
+			expectedScope: "repo",
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedScope, TokenStatus{Scopes: test.scopes}.MissingScope())
+		})
+	}
+}
+
+func TestEstimateScan(t *testing.T) {
+	currentYear := time.Now().Year()
+
+	tokens := []TokenStatus{
+		{Name: "token 1", Limit: 5000, Remaining: 5000, ResetAt: time.Now().Add(time.Hour)},
+	}
+
+	tests := map[string]struct {
+		ctx        *context.Context
+		stargazers int
+
+		expectedEstimate Estimate
+	}{
+		"every stargazer": {
+			ctx: &context.Context{
+				Stars:     1000,
+				SinceYear: currentYear,
+			},
+			stargazers: 150,
+
+			expectedEstimate: Estimate{
+				Stargazers:      150,
+				Years:           1,
+				Queries:         19,
+				Cost:            19,
+				AvatarDownloads: 150,
+				Duration:        27 * time.Second,
+			},
+		},
+		"sample of stargazers": {
+			ctx: &context.Context{
+				Stars:     1000,
+				SinceYear: currentYear - 1,
+				Workers:   4,
+			},
+			stargazers: 50000,
+
+			expectedEstimate: Estimate{
+				Stargazers:      1000,
+				Years:           2,
+				Queries:         201,
+				RESTRequests:    400,
+				Cost:            201,
+				AvatarDownloads: 1000,
+				Duration:        553 * time.Second,
+			},
+		},
+		"scan all": {
+			ctx: &context.Context{
+				Stars:     1000,
+				ScanAll:   true,
+				SinceYear: currentYear,
+				Workers:   4,
+			},
+			stargazers: 2000,
+
+			expectedEstimate: Estimate{
+				Stargazers:      2000,
+				Years:           1,
+				Queries:         221,
+				Cost:            221,
+				AvatarDownloads: 2000,
+				Duration:        96 * time.Second,
+			},
+		},
+		"several years of contributions": {
+			ctx: &context.Context{
+				Stars:     1000,
+				SinceYear: currentYear - 9,
+			},
+			stargazers: 90,
+
+			expectedEstimate: Estimate{
+				Stargazers:      90,
+				Years:           10,
+				Queries:         12,
+				Cost:            12,
+				AvatarDownloads: 90,
+				Duration:        62 * time.Second,
+			},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			estimate := EstimateScan(test.ctx, &Preflight{
+				Stargazers: test.stargazers,
+				Tokens:     tokens,
+			})
+
+			assert.Equal(t, test.expectedEstimate, estimate)
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	tests := map[string]struct {
+		tokens []TokenStatus
+		cost   int
+
+		expectedWait time.Duration
+	}{
+		"enough budget": {
+			tokens: []TokenStatus{{Limit: 5000, Remaining: 100, ResetAt: time.Now().Add(30 * time.Minute)}},
+			cost:   50,
+
+			expectedWait: 0,
+		},
+		"one rate limit window": {
+			tokens: []TokenStatus{{Limit: 5000, Remaining: 10, ResetAt: time.Now().Add(30 * time.Minute)}},
+			cost:   100,
+
+			expectedWait: 30 * time.Minute,
+		},
+		"several rate limit windows": {
+			tokens: []TokenStatus{
+				{Limit: 100, Remaining: 5, ResetAt: time.Now().Add(40 * time.Minute)},
+				{Limit: 100, Remaining: 5, ResetAt: time.Now().Add(30 * time.Minute)},
+			},
+			cost: 410,
+
+			expectedWait: 30*time.Minute + time.Hour,
+		},
+		"rate limited tokens": {
+			tokens: []TokenStatus{{ResetAt: time.Now().Add(10 * time.Minute)}},
+			cost:   10,
+
+			expectedWait: 10 * time.Minute,
+		},
+		"budget already restored": {
+			tokens: []TokenStatus{{Limit: 100, Remaining: 0, ResetAt: time.Now().Add(-time.Minute)}},
+			cost:   50,
+
+			expectedWait: 0,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			wait := rateLimitWait(test.tokens, test.cost)
+			assert.InDelta(t, float64(test.expectedWait), float64(wait), float64(time.Second))
+		})
+	}
+}
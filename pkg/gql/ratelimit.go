@@ -0,0 +1,232 @@
+package gql
+
+import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// When the remaining rate limit of the token goes under this
+	// threshold, requests are paused until the rate limit resets.
+	rateLimitThreshold = 10
+
+	// GitHub recommends to wait for at least a minute after hitting a
+	// secondary rate limit, when no Retry-After header is given.
+	defaultSecondaryLimitWait = time.Minute
+)
+
+// rateLimiter governs the rate at which requests are sent to the
+// GitHub API. It is shared between all of the workers of a scan,
+// so that they consume a single rate limit budget.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	limit     int
+	remaining int
+
+	// cost is the cost of the last request, which is used to
+	// estimate whether the remaining budget allows another one.
+	cost int
+
+	// resetAt is the time at which the current rate limit
+	// window ends and the budget is restored.
+	resetAt time.Time
+
+	// pausedUntil is the time until which no request can be sent,
+	// either because the budget was spent or because GitHub asked
+	// us to slow down.
+	pausedUntil time.Time
+}
+
+// wait blocks until the caller is allowed to send a request, or until
+// the given context is cancelled.
+func (r *rateLimiter) wait(cancelCtx gocontext.Context) error {
+	wait := time.Until(r.resumeAt())
+	if wait <= 0 {
+		return cancelCtx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-cancelCtx.Done():
+		return cancelCtx.Err()
+	}
+}
+
+// resumeAt returns the time at which requests can be sent again. It
+// is in the past when requests are not paused.
+func (r *rateLimiter) resumeAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.pausedUntil
+}
+
+// update updates the state of the rate limiter using the rate limit
+// information from a GitHub API response. It returns true if requests
+// just got paused until the rate limit resets.
+func (r *rateLimiter) update(rl rateLimit) bool {
+	resetAt, err := time.Parse(iso8601Format, rl.ResetAt)
+	if err != nil {
+		// Without a reset date, there is no way to know until when the
+		// remaining budget applies.
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case resetAt.After(r.resetAt):
+		// A new rate limit window started.
+		r.resetAt = resetAt
+		r.remaining = rl.Remaining
+	case resetAt.Equal(r.resetAt) && rl.Remaining < r.remaining:
+		// Responses from concurrent requests can arrive in any order,
+		// so the lowest remaining budget of a window is the right one.
+		r.remaining = rl.Remaining
+	case resetAt.Before(r.resetAt):
+		// Outdated response from a previous window.
+		return false
+	}
+
+	if rl.Limit > 0 {
+		r.limit = rl.Limit
+	}
+	if rl.Cost > 0 {
+		r.cost = rl.Cost
+	}
+
+	if r.remaining-r.cost > rateLimitThreshold {
+		return false
+	}
+
+	return r.pauseUntil(r.resetAt)
+}
+
+// pause pauses requests for the given duration, for example when
+// GitHub responds with a Retry-After header. It returns true if
+// requests were not already paused for that long.
+func (r *rateLimiter) pause(d time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.pauseUntil(time.Now().Add(d))
+}
+
+func (r *rateLimiter) pauseUntil(t time.Time) bool {
+	if !t.After(r.pausedUntil) {
+		return false
+	}
+
+	r.pausedUntil = t
+	return true
+}
+
+// budget returns the remaining rate limit budget of the token. It is
+// unlimited when unknown, since the token was not used during the
+// current rate limit window.
+func (r *rateLimiter) budget() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.resetAt.IsZero() || time.Now().After(r.resetAt) {
+		return math.MaxInt32
+	}
+
+	return r.remaining
+}
+
+// status returns a description of the current pause, or an empty
+// string if requests are not paused.
+func (r *rateLimiter) status() string {
+	resumeAt := r.resumeAt()
+
+	wait := time.Until(resumeAt)
+	if wait <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("Rate limited, resuming at %s (in %s)", resumeAt.Format("15:04:05"), wait.Round(time.Second))
+}
+
+// secondaryRateLimit checks whether a response from the GitHub API is
+// a rate limit error, and returns how long to wait before retrying.
+func secondaryRateLimit(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(date), true
+		}
+	}
+
+	// When the primary rate limit is exhausted, GitHub gives the time at
+	// which it resets instead of a Retry-After header.
+	if wait, exhausted := primaryRateLimit(resp.Header); exhausted {
+		return wait, true
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return defaultSecondaryLimitWait, true
+	}
+
+	// Other 403s are permission issues, unless their message says otherwise.
+	if !secondaryRateLimitMessage(resp) {
+		return 0, false
+	}
+
+	return defaultSecondaryLimitWait, true
+}
+
+// primaryRateLimit checks whether the headers of a response from the GitHub
+// API report that the budget of its token is exhausted, whatever the status
+// of the response, and returns how long to wait for it to be restored.
+func primaryRateLimit(header http.Header) (time.Duration, bool) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Until(time.Unix(reset, 0)), true
+}
+
+// secondaryRateLimitMessage returns whether or not the body of a response
+// mentions the secondary rate limit. The body is restored so that it can
+// still be read by the caller.
+func secondaryRateLimitMessage(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
@@ -0,0 +1,146 @@
+package gql
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterUpdate(t *testing.T) {
+	var limiter rateLimiter
+
+	resetAt := time.Now().Add(30 * time.Minute).UTC().Truncate(time.Second)
+	nextResetAt := resetAt.Add(time.Hour)
+
+	// Plenty of budget left.
+	assert.False(t, limiter.update(rateLimit{Limit: 5000, Cost: 1, Remaining: 4000, ResetAt: resetAt.Format(iso8601Format)}))
+	assert.Empty(t, limiter.status())
+
+	// Responses arriving out of order must not increase the remaining budget.
+	assert.False(t, limiter.update(rateLimit{Limit: 5000, Cost: 1, Remaining: 4500, ResetAt: resetAt.Format(iso8601Format)}))
+	assert.Equal(t, 4000, limiter.remaining)
+
+	// Not enough budget left for the cost of another request.
+	assert.True(t, limiter.update(rateLimit{Limit: 5000, Cost: 5, Remaining: 15, ResetAt: resetAt.Format(iso8601Format)}))
+	assert.Equal(t, resetAt, limiter.resumeAt())
+	assert.Contains(t, limiter.status(), "Rate limited, resuming at")
+
+	// Already paused until the reset.
+	assert.False(t, limiter.update(rateLimit{Limit: 5000, Cost: 5, Remaining: 10, ResetAt: resetAt.Format(iso8601Format)}))
+
+	// A response from the new window restores the budget.
+	assert.False(t, limiter.update(rateLimit{Limit: 5000, Cost: 5, Remaining: 5000, ResetAt: nextResetAt.Format(iso8601Format)}))
+	assert.Equal(t, 5000, limiter.remaining)
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	var limiter rateLimiter
+
+	assert.True(t, limiter.pause(time.Hour))
+	assert.False(t, limiter.pause(time.Minute))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), limiter.resumeAt(), time.Second)
+}
+
+func TestSecondaryRateLimit(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute)
+
+	tests := map[string]struct {
+		statusCode int
+		headers    map[string]string
+		body       string
+
+		expectedLimited bool
+		expectedWait    time.Duration
+	}{
+		"success": {
+			statusCode: http.StatusOK,
+		},
+		"retry after header": {
+			statusCode: http.StatusForbidden,
+			headers: map[string]string{
+				"Retry-After":           "42",
+				"X-RateLimit-Remaining": "4000",
+			},
+
+			expectedLimited: true,
+			expectedWait:    42 * time.Second,
+		},
+		"too many requests without header": {
+			statusCode: http.StatusTooManyRequests,
+
+			expectedLimited: true,
+			expectedWait:    defaultSecondaryLimitWait,
+		},
+		"primary rate limit exhausted": {
+			statusCode: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+			},
+
+			expectedLimited: true,
+			expectedWait:    time.Until(reset),
+		},
+		"secondary rate limit message": {
+			statusCode: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "4000",
+			},
+			body: `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`,
+
+			expectedLimited: true,
+			expectedWait:    defaultSecondaryLimitWait,
+		},
+		"forbidden": {
+			statusCode: http.StatusForbidden,
+		},
+		"forbidden with remaining budget": {
+			statusCode: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "4000",
+			},
+			body: `{"message":"Resource not accessible by integration"}`,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: test.statusCode,
+				Header:     make(http.Header),
+				Body:       ioutil.NopCloser(strings.NewReader(test.body)),
+			}
+			for key, value := range test.headers {
+				resp.Header.Set(key, value)
+			}
+
+			wait, limited := secondaryRateLimit(resp)
+
+			assert.Equal(t, test.expectedLimited, limited)
+			assert.InDelta(t, test.expectedWait, wait, float64(time.Second))
+
+			// The body can still be read to report the error.
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, test.body, string(body))
+		})
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	var limiter rateLimiter
+	limiter.pause(time.Hour)
+
+	cancelCtx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+
+	assert.Equal(t, gocontext.Canceled, limiter.wait(cancelCtx))
+	assert.NoError(t, new(rateLimiter).wait(gocontext.Background()))
+}
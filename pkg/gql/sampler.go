@@ -0,0 +1,226 @@
+package gql
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/Ullaakut/disgo"
+)
+
+// Request 100 stargazers per page from the REST API.
+const restPagination = 100
+
+// restPageLimit is the last page of stargazers served by the REST API.
+// Stargazers beyond it can only be reached by walking cursors.
+var restPageLimit = 400
+
+// restStargazer is a stargazer as listed by the REST API.
+type restStargazer struct {
+	StarredAt string `json:"starred_at"`
+	User      struct {
+		Login  string `json:"login"`
+		NodeID string `json:"node_id"`
+	} `json:"user"`
+}
+
+// isSampled returns whether or not only a sample of the given amount of
+// stargazers is scanned, in which case they don't all need to be listed.
+func isSampled(ctx *context.Context, totalUsers int) bool {
+	return totalUsers > 219 && !ctx.ScanAll && uint(totalUsers) >= ctx.Stars
+}
+
+// populationOf returns the amount of stargazers among which stargazers are
+// selected, out of the given amount of stargazers: the first ctx.Population
+// ones when it is set, so that the same seed selects the same stargazers
+// after the repository received new stars.
+func populationOf(ctx *context.Context, totalUsers int) int {
+	if ctx.Population != 0 && int(ctx.Population) < totalUsers {
+		return int(ctx.Population)
+	}
+
+	return totalUsers
+}
+
+// firstStargazers returns the amount of first stargazers that are selected
+// before random ones: 200, unless fewer stars are scanned.
+func firstStargazers(ctx *context.Context) int {
+	if !ctx.ScanAll && ctx.Stars < 200 {
+		return int(ctx.Stars)
+	}
+
+	return 200
+}
+
+// sampleStargazers selects a sample of stargazers among the given amount of
+// first stargazers like selectStargazers does, without listing every
+// stargazer. Selected stargazers are fetched by position from the pages of
+// the REST API, and the ones beyond its last page are found by walking
+// cursors back from the given page of latest stargazers. It also returns
+// the cursor of the last stargazer.
+func sampleStargazers(cancelCtx gocontext.Context, ctx *context.Context, client *client, latest *stargazers, population int, seed int64) ([]Stargazer, string, error) {
+	totalUsers := latest.TotalCount
+	lastCursor := latest.Meta.cursor()
+
+	// The first stargazers are not part of any stratum.
+	first := firstStargazers(ctx)
+	strata := make(map[int]int)
+	for position := 0; position < first; position++ {
+		strata[position] = 0
+	}
+
+	amount := int(ctx.Stars) - first
+	disgo.Infof("Selecting %d first stargazers and %d random stargazers out of %d, from %d slices of the stargazer timeline\n", first, amount, population, strataCount(ctx))
+
+	picks, pickStrata := pickStratified(population-first, amount, strataCount(ctx), seed)
+	for idx, pick := range picks {
+		strata[pick+first] = pickStrata[idx]
+	}
+
+	var positions []int
+	for position := range strata {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+
+	// The latest stargazers are known, and stargazers that are beyond the
+	// last page of the REST API are found by walking cursors back from them.
+	found := make(map[int]Stargazer)
+	page := latest
+	walkedFrom := totalUsers
+	for {
+		walkedFrom -= len(page.Users)
+		for idx, user := range page.Users {
+			found[walkedFrom+idx] = Stargazer{ID: user.ID, StarredAt: user.StarredAt}
+		}
+
+		if len(page.Users) == 0 || len(page.Meta) == 0 || !beyondRESTLimit(positions, walkedFrom) {
+			break
+		}
+
+		var err error
+		page, err = fetchLatestStargazers(cancelCtx, ctx, client, page.Meta[0].Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	fetched := make(map[int]bool)
+	for _, position := range positions {
+		pageNumber := position/restPagination + 1
+		if _, ok := found[position]; ok || fetched[pageNumber] || pageNumber > restPageLimit {
+			continue
+		}
+		fetched[pageNumber] = true
+
+		restPage, err := fetchRESTPage(cancelCtx, ctx, client, pageNumber)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for idx, stargazer := range restPage {
+			found[(pageNumber-1)*restPagination+idx] = Stargazer{
+				ID:        stargazer.User.NodeID,
+				StarredAt: stargazer.StarredAt,
+			}
+		}
+	}
+
+	var sample []Stargazer
+	for _, position := range positions {
+		stargazer, ok := found[position]
+		if !ok {
+			// The stargazer might have unstarred the repository since
+			// the stargazers were counted.
+			continue
+		}
+
+		stargazer.Stratum = strata[position]
+		sample = append(sample, stargazer)
+	}
+
+	return sample, lastCursor, nil
+}
+
+// beyondRESTLimit returns whether or not some of the given positions are
+// beyond the last page of the REST API, and before the given position.
+func beyondRESTLimit(positions []int, before int) bool {
+	for _, position := range positions {
+		if position >= restPageLimit*restPagination && position < before {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchLatestStargazers lists the latest stargazers of the repository
+// before the given cursor, along with the total amount of stargazers.
+// Since new stargazers can appear at any time, responses are not cached.
+func fetchLatestStargazers(cancelCtx gocontext.Context, ctx *context.Context, client *client, cursor string) (*stargazers, error) {
+	req, err := client.newRequest(fetchLatestUsersQuery, listStargazersVariables(ctx, listPagination, cursor))
+	if err != nil {
+		return nil, disgo.FailStepf("unable to prepare request: %v", err)
+	}
+
+	response, responseBody, err := client.query(cancelCtx, req)
+	if cancelCtx.Err() != nil {
+		return nil, disgo.FailStepf("scan interrupted: %v", cancelCtx.Err())
+	}
+
+	if err != nil {
+		return nil, wrapError(err, disgo.FailStepf("failed to fetch latest stargazers: %v. last body recieved: %s", err, responseBody))
+	}
+
+	return &response.Repository.Stargazers, nil
+}
+
+// fetchRESTPage lists a page of stargazers from the REST API, either from
+// the cache or from the GitHub API. Only full pages are cached, since the
+// last page might get new stargazers.
+func fetchRESTPage(cancelCtx gocontext.Context, ctx *context.Context, client *client, page int) ([]restStargazer, error) {
+	req, err := client.newRESTRequest(fmt.Sprintf("/repos/%s/%s/stargazers?per_page=%d&page=%d", ctx.RepoOwner, ctx.RepoName, restPagination, page))
+	if err != nil {
+		return nil, disgo.FailStepf("unable to prepare request: %v", err)
+	}
+
+	resp, err := getCache(ctx, req, restFilePagination(page))
+	if err != nil {
+		return nil, disgo.FailStepf("unable to get cached file: %v", err)
+	}
+
+	var listed []restStargazer
+	if resp != nil {
+		err = json.NewDecoder(resp.Body).Decode(&listed)
+		resp.Body.Close()
+		if err == nil && len(listed) == restPagination {
+			return listed, nil
+		}
+	}
+
+	responseBody, err := client.get(cancelCtx, req)
+	if cancelCtx.Err() != nil {
+		return nil, disgo.FailStepf("scan interrupted: %v", cancelCtx.Err())
+	}
+
+	if err != nil {
+		return nil, wrapError(err, disgo.FailStepf("failed to fetch page %d of stargazers: %v", page, err))
+	}
+
+	listed = nil
+	err = json.Unmarshal(responseBody, &listed)
+	if err != nil {
+		return nil, disgo.FailStepf("unable to unmarshal stargazers: %v", err)
+	}
+
+	if len(listed) == restPagination {
+		err = putCache(ctx, req, restFilePagination(page), responseBody)
+		if err != nil {
+			return nil, disgo.FailStepf("unable to write stargazers to cache: %v", err)
+		}
+	}
+
+	return listed, nil
+}
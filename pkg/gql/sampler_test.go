@@ -0,0 +1,202 @@
+package gql
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestFetchStargazersSample(t *testing.T) {
+	tests := map[string]struct {
+		pageLimit int
+		stars     uint
+
+		expectedListRequests int32
+	}{
+		"every stargazer within the REST API limit": {
+			pageLimit: 400,
+			stars:     300,
+
+			expectedListRequests: 1,
+		},
+		"stargazers beyond the REST API limit": {
+			pageLimit: 4,
+			stars:     300,
+
+			expectedListRequests: 6,
+		},
+		"star limit below the first stargazers": {
+			pageLimit: 400,
+			stars:     100,
+
+			expectedListRequests: 1,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			defer func(limit int) { restPageLimit = limit }(restPageLimit)
+			restPageLimit = test.pageLimit
+
+			var listRequests int32
+			server := fakeStargazers(t, 1000, func(w http.ResponseWriter, request graphQLRequest) bool {
+				if _, ok := request.Variables["pagination"]; ok {
+					atomic.AddInt32(&listRequests, 1)
+				}
+				return true
+			})
+			defer server.Close()
+
+			cacheDir, err := ioutil.TempDir("", "astronomer")
+			require.NoError(t, err)
+			defer os.RemoveAll(cacheDir)
+
+			ctx := &context.Context{
+				RepoOwner:          "ullaakut",
+				RepoName:           "astronomer",
+				CacheDirectoryPath: cacheDir,
+				GraphQLEndpoint:    server.URL,
+				Stars:              test.stars,
+				Strata:             5,
+				Seed:               42,
+			}
+
+			sample, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+			require.NoError(t, err)
+
+			// Stargazers beyond the REST API limit are found by walking
+			// cursors back from the latest stargazer.
+			assert.Equal(t, test.expectedListRequests, atomic.LoadInt32(&listRequests))
+			assert.Equal(t, uint(1000), totalUsers)
+			assert.Len(t, sample, int(test.stars))
+
+			// The sample is the same as if every stargazer had been listed.
+			assert.Equal(t, selectStargazers(ctx, fakeSample(1000), 42), sample)
+
+			plan, err := loadScanPlan(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "u999", plan.LastCursor)
+		})
+	}
+}
+
+func TestFetchStargazersPopulation(t *testing.T) {
+	tests := map[string]struct {
+		stars   uint
+		scanAll bool
+	}{
+		"sample of stargazers": {
+			stars: 300,
+		},
+		"every stargazer": {
+			stars:   300,
+			scanAll: true,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			scan := func(stargazers int, population uint) ([]Stargazer, *context.Context) {
+				server := fakeStargazers(t, stargazers, func(w http.ResponseWriter, request graphQLRequest) bool {
+					return true
+				})
+				defer server.Close()
+
+				cacheDir, err := ioutil.TempDir("", "astronomer")
+				require.NoError(t, err)
+				defer os.RemoveAll(cacheDir)
+
+				ctx := &context.Context{
+					RepoOwner:          "ullaakut",
+					RepoName:           "astronomer",
+					CacheDirectoryPath: cacheDir,
+					GraphQLEndpoint:    server.URL,
+					Stars:              test.stars,
+					ScanAll:            test.scanAll,
+					Strata:             5,
+					Seed:               42,
+					Population:         population,
+				}
+
+				sample, totalUsers, err := FetchStargazers(gocontext.Background(), ctx)
+				require.NoError(t, err)
+				assert.Equal(t, ctx.Population, totalUsers)
+
+				plan, err := loadScanPlan(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, totalUsers, plan.TotalUsers)
+				if population != 0 {
+					assert.Empty(t, plan.LastCursor)
+				}
+
+				return sample, ctx
+			}
+
+			// The population of the first scan is recorded, so that scanning
+			// again with it once the repository received new stars selects
+			// the same stargazers.
+			first, ctx := scan(800, 0)
+			assert.Equal(t, uint(800), ctx.Population)
+
+			again, ctx := scan(1000, ctx.Population)
+			assert.Equal(t, uint(800), ctx.Population)
+			assert.Equal(t, first, again)
+		})
+	}
+}
+
+func TestFetchRESTPage(t *testing.T) {
+	stargazers := fakeStargazers(t, 150, func(w http.ResponseWriter, request graphQLRequest) bool {
+		return true
+	})
+	defer stargazers.Close()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "application/vnd.github.v3.star+json", r.Header.Get("Accept"))
+		assert.Equal(t, "Bearer fakeToken", r.Header.Get("Authorization"))
+
+		stargazers.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		GithubTokens:       []string{"fakeToken"},
+		CacheDirectoryPath: cacheDir,
+		RESTEndpoint:       server.URL + "/v3",
+	}
+
+	client, err := newClient(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		page, err := fetchRESTPage(gocontext.Background(), ctx, client, 1)
+		require.NoError(t, err)
+		require.Len(t, page, 100)
+		assert.Equal(t, "id-u0", page[0].User.NodeID)
+		assert.Equal(t, "2019-06-01T12:00:00Z", page[0].StarredAt)
+
+		page, err = fetchRESTPage(gocontext.Background(), ctx, client, 2)
+		require.NoError(t, err)
+		require.Len(t, page, 50)
+		assert.Equal(t, "id-u100", page[0].User.NodeID)
+	}
+
+	// Full pages are cached, but the last page might get new stargazers.
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
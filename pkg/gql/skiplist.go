@@ -0,0 +1,141 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+// skipListFilename is the name of the file in which the skip list is
+// stored, at the root of the cache directory.
+const skipListFilename = "skiplist.json"
+
+// skipList contains the users for which the GitHub API keeps timing out
+// when fetching their contributions. It is persisted in the cache
+// directory, so that later scans skip them right away instead of
+// isolating them again.
+type skipList struct {
+	mu sync.Mutex
+
+	Users []skippedUser `json:"users"`
+}
+
+// skippedUser is a user whose contributions can't be fetched.
+type skippedUser struct {
+	Login string `json:"login"`
+
+	// Repository is the repository that was being scanned when the user
+	// was skipped, and Page is the key of the page of contributions
+	// in which the user was found.
+	Repository string `json:"repository"`
+	Page       string `json:"page"`
+
+	// Year is the year for which fetching contributions timed out.
+	Year int `json:"year"`
+}
+
+// skipListPath returns the path of the skip list of the cache directory.
+func skipListPath(ctx *context.Context) string {
+	return filepath.Join(ctx.CacheDirectoryPath, skipListFilename)
+}
+
+// loadSkipList loads the skip list of the cache directory. It returns
+// an empty skip list if none was found.
+func loadSkipList(ctx *context.Context) (*skipList, error) {
+	data, err := ioutil.ReadFile(skipListPath(ctx))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &skipList{}, nil
+		}
+		return nil, fmt.Errorf("unable to read skip list: %v", err)
+	}
+
+	var list skipList
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse skip list: %v", err)
+	}
+
+	return &list, nil
+}
+
+// add adds a user to the skip list and writes it in the cache directory.
+func (l *skipList) add(ctx *context.Context, user skippedUser) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Users = append(l.Users, user)
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal skip list: %v", err)
+	}
+
+	err = writeFileAtomic(skipListPath(ctx), data)
+	if err != nil {
+		return fmt.Errorf("unable to write skip list: %v", err)
+	}
+
+	return nil
+}
+
+// contains returns whether or not the given user was skipped for any of
+// the given years.
+func (l *skipList) contains(login string, years ...int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, user := range l.Users {
+		if user.Login == login && containsYear(years, user.Year) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsYear returns whether or not a year is part of the given years.
+func containsYear(years []int, year int) bool {
+	for _, y := range years {
+		if y == year {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter removes skipped users from the given list of users, and adds them
+// to the given dropped users. Their contributions are only known for some
+// of the years, which would skew the trust report.
+func (l *skipList) filter(users []User, dropped *droppedUsers) []User {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	skipped := make(map[string]bool)
+	for _, user := range l.Users {
+		skipped[user.Login] = true
+	}
+
+	var filtered []User
+	for _, user := range users {
+		if skipped[user.Login] {
+			dropped.add(DroppedUser{ID: user.ID, Login: user.Login, Reason: "contributions kept timing out"})
+			continue
+		}
+
+		filtered = append(filtered, user)
+	}
+
+	return filtered
+}
+
+// repositoryName returns the full name of the scanned repository.
+func repositoryName(ctx *context.Context) string {
+	return ctx.RepoOwner + "/" + ctx.RepoName
+}
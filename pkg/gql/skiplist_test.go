@@ -0,0 +1,119 @@
+package gql
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipList(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+	}
+
+	list, err := loadSkipList(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list.Users)
+
+	require.NoError(t, list.add(ctx, skippedUser{
+		Login:      "jstrachan",
+		Repository: "ullaakut/astronomer",
+		Page:       "c1",
+		Year:       2019,
+	}))
+
+	// The skip list is shared by every repository of the cache directory.
+	loaded, err := loadSkipList(&context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "cameradar",
+		CacheDirectoryPath: cacheDir,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, list.Users, loaded.Users)
+
+	assert.True(t, loaded.contains("jstrachan", 2019))
+	assert.True(t, loaded.contains("jstrachan", 2018, 2019))
+	assert.False(t, loaded.contains("jstrachan", 2018))
+
+	dropped := &droppedUsers{}
+	assert.Equal(t, []User{{Login: "titi"}}, loaded.filter([]User{{ID: "id-jstrachan", Login: "jstrachan"}, {Login: "titi"}}, dropped))
+	assert.Equal(t, []DroppedUser{{ID: "id-jstrachan", Login: "jstrachan", Reason: "contributions kept timing out"}}, dropped.list())
+}
+
+func TestFetchContributionsIsolatesTimeouts(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+
+	currentYear := time.Now().Year()
+
+	var timeouts int32
+	server := fakeStargazers(t, 4, func(w http.ResponseWriter, request graphQLRequest) bool {
+		// The GitHub API times out when fetching the contributions of u2.
+		if isProfilesQuery(request) {
+			return true
+		}
+
+		ids, _ := request.Variables["ids"].([]interface{})
+		for _, id := range ids {
+			if id == "id-u2" {
+				atomic.AddInt32(&timeouts, 1)
+				w.WriteHeader(http.StatusBadGateway)
+				return false
+			}
+		}
+		return true
+	})
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "astronomer")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ctx := &context.Context{
+		RepoOwner:          "ullaakut",
+		RepoName:           "astronomer",
+		CacheDirectoryPath: cacheDir,
+		GraphQLEndpoint:    server.URL,
+		Stars:              20,
+		Workers:            2,
+	}
+
+	users, dropped, err := FetchContributions(gocontext.Background(), ctx, fakeSample(4), currentYear-1)
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, []DroppedUser{{ID: "id-u2", Login: "u2", Reason: "contributions kept timing out"}}, dropped)
+
+	for idx, login := range []string{"u0", "u1", "u3"} {
+		assert.Equal(t, login, users[idx].Login)
+		assert.Equal(t, map[int]int{currentYear: 2, currentYear - 1: 1}, users[idx].YearlyContributions)
+	}
+
+	skipped, err := loadSkipList(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []skippedUser{
+		{Login: "u2", Repository: "ullaakut/astronomer", Page: pageKey(fakeSample(4)), Year: currentYear},
+		{Login: "u2", Repository: "ullaakut/astronomer", Page: pageKey(fakeSample(4)), Year: currentYear - 1},
+	}, skipped.Users)
+
+	// The next scan skips the user without waiting for timeouts.
+	atomic.StoreInt32(&timeouts, 0)
+
+	users, _, err = FetchContributions(gocontext.Background(), ctx, fakeSample(4), currentYear-1)
+	require.NoError(t, err)
+	assert.Len(t, users, 3)
+	assert.Zero(t, atomic.LoadInt32(&timeouts))
+}
@@ -0,0 +1,132 @@
+package gql
+
+import (
+	gocontext "context"
+	"sync"
+	"time"
+)
+
+// token is a GitHub token along with the rate limiter of its budget.
+type token struct {
+	value   string
+	limiter rateLimiter
+
+	// app is set for the installation token of a GitHub App, which
+	// is refreshed before it expires.
+	app *appInstallation
+}
+
+// credentials returns the value to authorize requests with.
+func (t *token) credentials(cancelCtx gocontext.Context) (string, error) {
+	if t.app == nil {
+		return t.value, nil
+	}
+
+	return t.app.accessToken(cancelCtx)
+}
+
+// tokenPool distributes requests between several GitHub tokens, so that
+// scans can use the rate limit budget of multiple accounts. Each request
+// is sent with the token that has the most remaining budget.
+type tokenPool struct {
+	mu sync.Mutex
+
+	tokens []*token
+
+	// onPause is called with the status of the pool when every
+	// token is rate limited, if set.
+	onPause func(status string)
+}
+
+// newTokenPool creates a pool from the given tokens and GitHub App
+// installation, if any. Without any of them, requests are sent
+// unauthenticated.
+func newTokenPool(values []string, app *appInstallation) *tokenPool {
+	pool := &tokenPool{}
+	for _, value := range values {
+		pool.tokens = append(pool.tokens, &token{value: value})
+	}
+
+	if app != nil {
+		pool.tokens = append(pool.tokens, &token{app: app})
+	}
+
+	if len(pool.tokens) == 0 {
+		pool.tokens = append(pool.tokens, &token{})
+	}
+
+	return pool
+}
+
+// acquire returns the token to use for the next request. It blocks
+// until a token can be used, or until the given context is cancelled.
+func (p *tokenPool) acquire(cancelCtx gocontext.Context) (*token, error) {
+	t := p.best()
+	if err := t.limiter.wait(cancelCtx); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// best returns the token with the most remaining budget among those that
+// are not rate limited. If all of them are, it returns the one that can
+// be used again the soonest.
+func (p *tokenPool) best() *token {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		best       *token
+		bestBudget = -1
+		soonest    *token
+		now        = time.Now()
+	)
+	for _, t := range p.tokens {
+		if t.limiter.resumeAt().After(now) {
+			if soonest == nil || t.limiter.resumeAt().Before(soonest.limiter.resumeAt()) {
+				soonest = t
+			}
+			continue
+		}
+
+		if budget := t.limiter.budget(); budget > bestBudget {
+			best, bestBudget = t, budget
+		}
+	}
+
+	if best == nil {
+		return soonest
+	}
+
+	return best
+}
+
+// update updates the rate limiter of a token using the rate limit
+// information from a GitHub API response.
+func (p *tokenPool) update(t *token, rl rateLimit) {
+	if t.limiter.update(rl) {
+		p.notify()
+	}
+}
+
+// pause pauses requests with a token for the given duration.
+func (p *tokenPool) pause(t *token, d time.Duration) {
+	if t.limiter.pause(d) {
+		p.notify()
+	}
+}
+
+// notify calls the onPause callback of the pool if every token
+// is rate limited.
+func (p *tokenPool) notify() {
+	if status := p.status(); status != "" && p.onPause != nil {
+		p.onPause(status)
+	}
+}
+
+// status returns a description of the current pause, or an empty
+// string if at least one token can be used.
+func (p *tokenPool) status() string {
+	return p.best().limiter.status()
+}
@@ -0,0 +1,144 @@
+package gql
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenPoolBest(t *testing.T) {
+	resetAt := time.Now().Add(30 * time.Minute).UTC().Format(iso8601Format)
+
+	pool := newTokenPool([]string{"a", "b", "c"}, nil)
+
+	// Tokens with an unknown budget are used first.
+	assert.Equal(t, "a", pool.best().value)
+
+	pool.update(pool.tokens[0], rateLimit{Remaining: 3000, ResetAt: resetAt})
+	assert.Equal(t, "b", pool.best().value)
+
+	pool.update(pool.tokens[1], rateLimit{Remaining: 4000, ResetAt: resetAt})
+	pool.update(pool.tokens[2], rateLimit{Remaining: 2000, ResetAt: resetAt})
+	assert.Equal(t, "b", pool.best().value)
+	assert.Empty(t, pool.status())
+
+	// Rate limited tokens are not used.
+	pool.pause(pool.tokens[1], time.Hour)
+	assert.Equal(t, "a", pool.best().value)
+
+	// When every token is rate limited, the one available the soonest is used.
+	var notified []string
+	pool.onPause = func(status string) {
+		notified = append(notified, status)
+	}
+
+	pool.pause(pool.tokens[0], 2*time.Hour)
+	assert.Empty(t, notified)
+
+	pool.pause(pool.tokens[2], 30*time.Minute)
+	assert.Equal(t, "c", pool.best().value)
+	require.Len(t, notified, 1)
+	assert.Contains(t, notified[0], "Rate limited, resuming at")
+}
+
+func TestNewTokenPoolWithoutTokens(t *testing.T) {
+	pool := newTokenPool(nil, nil)
+
+	require.Len(t, pool.tokens, 1)
+	assert.Empty(t, pool.best().value)
+}
+
+func TestQueryRotatesTokens(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+
+	resetAt := time.Now().Add(30 * time.Minute).UTC().Format(iso8601Format)
+	remaining := map[string]int{"a": 100, "b": 4000, "c": 3000}
+
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		used = append(used, token)
+
+		// Token c hits a secondary rate limit.
+		if token == "c" {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		remaining[token]--
+		fmt.Fprintf(w, `{"data":{"rateLimit":{"limit":5000,"cost":1,"remaining":%d,"resetAt":%q}}}`, remaining[token], resetAt)
+	}))
+	defer server.Close()
+
+	c, err := newClient(&context.Context{
+		GraphQLEndpoint: server.URL,
+		GithubTokens:    []string{"a", "b", "c"},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		req, err := c.newRequest(fetchUsersQuery, nil)
+		require.NoError(t, err)
+
+		_, _, err = c.query(gocontext.Background(), req)
+		require.NoError(t, err)
+	}
+
+	// Each token is tried once, then the one with the most remaining budget is used.
+	assert.Equal(t, []string{"a", "b", "c", "b", "b"}, used)
+}
+
+func TestQueryPausesExhaustedTokens(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	resetAt := time.Now().Add(30 * time.Minute).UTC().Format(iso8601Format)
+
+	var used []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		used = append(used, token)
+
+		// The budget of token a is exhausted, which GitHub reports
+		// in a successful response.
+		if token == "a" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			fmt.Fprint(w, `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded for user ID 1."}]}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"data":{"rateLimit":{"limit":5000,"cost":1,"remaining":4000,"resetAt":%q}}}`, resetAt)
+	}))
+	defer server.Close()
+
+	c, err := newClient(&context.Context{
+		GraphQLEndpoint: server.URL,
+		GithubTokens:    []string{"a", "b"},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		req, err := c.newRequest(fetchUsersQuery, nil)
+		require.NoError(t, err)
+
+		_, _, err = c.query(gocontext.Background(), req)
+		require.NoError(t, err)
+	}
+
+	// Token a is paused until its budget is restored, instead of being retried.
+	assert.Equal(t, 1, strings.Count(strings.Join(used, ""), "a"))
+	assert.WithinDuration(t, reset, c.tokens.tokens[0].limiter.resumeAt(), time.Second)
+}
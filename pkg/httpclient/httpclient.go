@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+// userAgent is the user agent of every request sent by astronomer.
+const userAgent = "Astronomer"
+
+// New creates the HTTP client through which all of the network traffic of
+// astronomer goes, according to the network settings of the given context.
+// When the context has a transport, it is used as is, and only the timeout
+// and user agent settings apply.
+func New(ctx *context.Context) (*http.Client, error) {
+	transport := ctx.Transport
+	if transport == nil {
+		var err error
+		transport, err = newTransport(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &http.Client{
+		Transport: &userAgentTransport{
+			userAgent: UserAgent(ctx),
+			next:      transport,
+		},
+		Timeout: ctx.Timeout,
+	}, nil
+}
+
+// UserAgent returns the user agent of the requests sent for the given context.
+func UserAgent(ctx *context.Context) string {
+	if ctx.UserAgentSuffix == "" {
+		return userAgent
+	}
+
+	return fmt.Sprintf("%s %s", userAgent, ctx.UserAgentSuffix)
+}
+
+// newTransport creates a copy of the default transport, that goes through
+// the proxy of the given context, and that trusts its certificate
+// authorities in addition to the system ones.
+func newTransport(ctx *context.Context) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if ctx.ProxyURL != "" {
+		proxyURL, err := url.Parse(ctx.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", ctx.ProxyURL, err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(ctx.CABundle) != 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(ctx.CABundle) {
+			return nil, errors.New("unable to find any PEM encoded certificate in the CA bundle")
+		}
+
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	return transport, nil
+}
+
+// userAgentTransport sets the user agent of every request it sends
+// through the next transport.
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper. Since round trippers must not
+// modify requests, the user agent is set on a copy of the request.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	withUserAgent := new(http.Request)
+	*withUserAgent = *req
+
+	withUserAgent.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		withUserAgent.Header[key] = values
+	}
+	withUserAgent.Header.Set("User-Agent", t.userAgent)
+
+	return t.next.RoundTrip(withUserAgent)
+}
@@ -0,0 +1,151 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/Ullaakut/astronomer/pkg/context"
+)
+
+func TestUserAgent(t *testing.T) {
+	tests := map[string]struct {
+		suffix string
+
+		expectedUserAgent string
+	}{
+		"without suffix": {
+			expectedUserAgent: "Astronomer",
+		},
+		"with suffix": {
+			suffix: "acme-ci/1.2",
+
+			expectedUserAgent: "Astronomer acme-ci/1.2",
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			var userAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+			}))
+			defer server.Close()
+
+			client, err := New(&context.Context{UserAgentSuffix: test.suffix})
+			require.NoError(t, err)
+
+			req, err := http.NewRequest("GET", server.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", "Go-http-client")
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, test.expectedUserAgent, userAgent)
+
+			// The request itself is left untouched.
+			assert.Equal(t, "Go-http-client", req.Header.Get("User-Agent"))
+		})
+	}
+}
+
+func TestNewWithCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	// The certificate of the server is not trusted by default.
+	client, err := New(&context.Context{})
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	client, err = New(&context.Context{CABundle: bundle})
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = New(&context.Context{CABundle: []byte("not a certificate")})
+	assert.Error(t, err)
+}
+
+func TestNewWithProxy(t *testing.T) {
+	var proxiedURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := New(&context.Context{ProxyURL: proxy.URL})
+	require.NoError(t, err)
+
+	resp, err := client.Get("http://api.github.invalid/graphql")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "http://api.github.invalid/graphql", proxiedURL)
+
+	_, err = New(&context.Context{ProxyURL: "://invalid"})
+	assert.Error(t, err)
+}
+
+func TestNewWithTransport(t *testing.T) {
+	var sent *http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody, Request: req}, nil
+	})
+
+	client, err := New(&context.Context{
+		Transport:       transport,
+		UserAgentSuffix: "acme",
+		Timeout:         time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, client.Timeout)
+
+	resp, err := client.Get("https://api.github.com/graphql")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	require.NotNil(t, sent)
+	assert.Equal(t, "Astronomer acme", sent.Header.Get("User-Agent"))
+}
+
+// roundTripperFunc is a function that implements http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewTransportKeepsDefaults(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	transport, err := newTransport(&context.Context{CABundle: bundle})
+	require.NoError(t, err)
+
+	// HTTP/2 is still attempted, like with the default transport.
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSClientConfig.RootCAs)
+
+	// The default transport is left untouched.
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	assert.True(t, defaultTransport.TLSClientConfig == nil || defaultTransport.TLSClientConfig.RootCAs == nil)
+}
@@ -10,9 +10,9 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"net/http"
 
 	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/Ullaakut/astronomer/pkg/httpclient"
 	"github.com/Ullaakut/astronomer/pkg/trust"
 	"github.com/Ullaakut/disgo"
 )
@@ -35,7 +35,7 @@ func SendReport(ctx *context.Context, report *trust.Report) error {
 		return err
 	}
 
-	return sendReport(SignedReport{
+	return sendReport(ctx, SignedReport{
 		Report:          report,
 		RepositoryOwner: ctx.RepoOwner,
 		RepositoryName:  ctx.RepoName,
@@ -69,16 +69,22 @@ func signReport(report *trust.Report) ([]byte, error) {
 	return signature, nil
 }
 
-func sendReport(report SignedReport) error {
+func sendReport(ctx *context.Context, report SignedReport) error {
 	data, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("unable to marshal signed report: %v", err)
 	}
 
-	response, err := http.Post("https://astronomer.ullaakut.eu", "application/json", bytes.NewReader(data))
+	client, err := httpclient.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Post("https://astronomer.ullaakut.eu", "application/json", bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("unable to send signed report to astronomer server: %v", err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 201 {
 		return fmt.Errorf("astronomer server did not trust this report: %v", response.Status)
@@ -0,0 +1,148 @@
+package trust
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/gql"
+	"github.com/montanaflynn/stats"
+)
+
+const (
+	// Stars are counted per week to build the star velocity of a repository.
+	burstBucketDuration = 7 * 24 * time.Hour
+
+	// Minimum amount of dated stars and weeks needed to have a meaningful
+	// baseline to compare bursts against.
+	burstMinimumStars   = 50
+	burstMinimumBuckets = 8
+
+	// A week is considered suspicious if its amount of stars deviates from
+	// the median by more than this many (MAD-based) standard deviations...
+	burstDeviations = 5
+
+	// ...is at least this many times higher than the average weekly amount
+	// of stars...
+	burstRateMultiplier = 4
+
+	// ...and contains at least this many stars. Like every amount of stars
+	// in bursts, it counts the scanned stargazers, so sparse samples only
+	// reveal large bursts.
+	burstMinimumWeeklyStars = 5
+
+	// Scale factor to use the median absolute deviation as a consistent
+	// estimator of the standard deviation.
+	madScale = 1.4826
+)
+
+// StarBurst represents a window of time during which a repository received
+// an anomalous amount of stars compared to its own baseline.
+type StarBurst struct {
+	Start time.Time
+	End   time.Time
+
+	// Stars is the amount of scanned stargazers who starred
+	// the repository during this window. When only a sample of
+	// the stargazers is scanned, it is not scaled to estimate the
+	// real amount of stars, which is higher.
+	Stars int
+}
+
+// detectStarBursts builds the weekly star velocity of the given stargazers,
+// and looks for weeks during which it spikes compared to the rest of the
+// timeline. It returns the star burst factor, in which the value is the
+// percentage of stars that arrived during bursts, along with the suspicious
+// windows. If there are not enough dated stars to compute a baseline, ok is
+// set to false.
+func detectStarBursts(users []gql.User) (factor Factor, bursts []StarBurst, ok bool) {
+	var dates []time.Time
+	for _, user := range users {
+		date, err := time.Parse(time.RFC3339, user.StarredAt)
+		if err != nil {
+			continue
+		}
+
+		dates = append(dates, date.UTC())
+	}
+
+	if len(dates) < burstMinimumStars {
+		return Factor{}, nil, false
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	// Build the time series of weekly stars, starting from the first star.
+	first := time.Date(dates[0].Year(), dates[0].Month(), dates[0].Day(), 0, 0, 0, 0, time.UTC)
+	buckets := make([]float64, int(dates[len(dates)-1].Sub(first)/burstBucketDuration)+1)
+	for _, date := range dates {
+		buckets[int(date.Sub(first)/burstBucketDuration)]++
+	}
+
+	if len(buckets) < burstMinimumBuckets {
+		return Factor{}, nil, false
+	}
+
+	threshold, err := burstThreshold(buckets)
+	if err != nil {
+		return Factor{}, nil, false
+	}
+
+	// Merge consecutive suspicious weeks into windows.
+	var burstStars int
+	for idx, stars := range buckets {
+		if stars < threshold {
+			continue
+		}
+
+		start := first.Add(time.Duration(idx) * burstBucketDuration)
+		end := start.Add(burstBucketDuration).AddDate(0, 0, -1)
+
+		if len(bursts) > 0 && bursts[len(bursts)-1].End.AddDate(0, 0, 1).Equal(start) {
+			bursts[len(bursts)-1].End = end
+			bursts[len(bursts)-1].Stars += int(stars)
+		} else {
+			bursts = append(bursts, StarBurst{
+				Start: start,
+				End:   end,
+				Stars: int(stars),
+			})
+		}
+
+		burstStars += int(stars)
+	}
+
+	share := 100 * float64(burstStars) / float64(len(dates))
+
+	return Factor{
+		Value:        share,
+		TrustPercent: computeTrustFromInverseScore(share, factorReferences[StarBurstFactor]),
+	}, bursts, true
+}
+
+// burstThreshold computes the amount of stars from which a week
+// is considered to be anomalous.
+func burstThreshold(buckets []float64) (float64, error) {
+	median, err := stats.Median(buckets)
+	if err != nil {
+		return 0, err
+	}
+
+	mad, err := stats.MedianAbsoluteDeviationPopulation(buckets)
+	if err != nil {
+		return 0, err
+	}
+
+	mean, err := stats.Mean(buckets)
+	if err != nil {
+		return 0, err
+	}
+
+	threshold := median + burstDeviations*madScale*mad
+	threshold = math.Max(threshold, burstRateMultiplier*mean)
+	threshold = math.Max(threshold, burstMinimumWeeklyStars)
+
+	return threshold, nil
+}
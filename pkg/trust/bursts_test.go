@@ -0,0 +1,77 @@
+package trust
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/astronomer/pkg/gql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectStarBursts(t *testing.T) {
+	start := time.Date(2019, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	var steadyUsers []gql.User
+	for i := 0; i < 120; i++ {
+		steadyUsers = append(steadyUsers, gql.User{
+			StarredAt: start.AddDate(0, 0, 3*i).Format(time.RFC3339),
+		})
+	}
+
+	// 40 stars within two days of March 2019.
+	burstUsers := append([]gql.User{}, steadyUsers...)
+	for i := 0; i < 40; i++ {
+		burstUsers = append(burstUsers, gql.User{
+			StarredAt: start.AddDate(0, 2, 0).Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+		})
+	}
+
+	tests := map[string]struct {
+		users []gql.User
+
+		expectedOK     bool
+		expectedBursts []StarBurst
+		expectedFactor Factor
+	}{
+		"not enough stars": {
+			users: steadyUsers[:20],
+		},
+		"missing star dates": {
+			users: make([]gql.User, 200),
+		},
+		"steady stars": {
+			users: steadyUsers,
+
+			expectedOK:     true,
+			expectedFactor: Factor{Value: 0, TrustPercent: 0.99},
+		},
+		"star burst": {
+			users: burstUsers,
+
+			expectedOK: true,
+			expectedBursts: []StarBurst{
+				{
+					Start: time.Date(2019, time.February, 26, 0, 0, 0, 0, time.UTC),
+					End:   time.Date(2019, time.March, 4, 0, 0, 0, 0, time.UTC),
+					Stars: 42,
+				},
+			},
+			expectedFactor: Factor{
+				Value:        100 * 42.0 / 160.0,
+				TrustPercent: 1 - (100*42.0/160.0)/factorReferences[StarBurstFactor],
+			},
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			factor, bursts, ok := detectStarBursts(test.users)
+			require.Equal(t, test.expectedOK, ok)
+
+			assert.Equal(t, test.expectedBursts, bursts)
+			assert.InDelta(t, test.expectedFactor.Value, factor.Value, 0.001)
+			assert.InDelta(t, test.expectedFactor.TrustPercent, factor.TrustPercent, 0.001)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package trust
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"time"
 
@@ -39,10 +40,107 @@ type Percentile string
 type Report struct {
 	Factors     map[FactorName]Factor
 	Percentiles map[Percentile]Factor
+
+	// StarBursts are the windows during which the repository
+	// received a suspicious amount of stars.
+	StarBursts []StarBurst
+
+	// Partial is set when the report was computed from an
+	// interrupted scan.
+	Partial bool
+
+	// Dropped is the amount of sampled stargazers that were left out of
+	// the report because some of their data could not be fetched, by
+	// reason.
+	Dropped map[string]int
+
+	// Strata contain the trust factors of the random stargazers of each
+	// slice of the stargazer timeline, in the order in which they starred
+	// the repository.
+	Strata []Stratum
+
+	// Seed is the seed with which stargazers were randomly selected,
+	// among the first Population stargazers of the repository. Scanning
+	// the repository again with the same seed, population and cache
+	// results in the same report.
+	Seed       int64
+	Population uint
+}
+
+// Stratum contains the trust factors of the stargazers that were randomly
+// selected from one slice of the stargazer timeline.
+type Stratum struct {
+	// Index of the slice in the stargazer timeline, starting at 1.
+	Index int
+
+	// Users is the amount of stargazers selected from the slice.
+	Users int
+
+	Factors map[FactorName]Factor
 }
 
 // Compute computes all trust factors for the stargazers of a repository.
 func Compute(ctx *context.Context, users []gql.User) (*Report, error) {
+	trustData := gatherTrustData(users)
+
+	disgo.StartStepf("Building trust report")
+
+	defer disgo.EndStep()
+
+	repoFactors := make(map[FactorName]Factor)
+	starBurstFactor, starBursts, ok := detectStarBursts(timelineUsers(users))
+	if ok {
+		repoFactors[StarBurstFactor] = starBurstFactor
+	}
+
+	refs := referencesFor(horizon(ctx))
+
+	var (
+		report *Report
+		err    error
+	)
+	if uint(len(users)) > 219 {
+		report, err = buildComparativeReport(users, trustData, repoFactors, refs)
+	} else {
+		report, err = buildReport(trustData, repoFactors, refs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.StarBursts = starBursts
+	report.Seed = ctx.Seed
+	report.Population = ctx.Population
+
+	report.Strata, err = computeStrata(users, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// timelineUsers returns the stargazers that are spread evenly over the
+// timeline of the repository. When only a portion of the stargazers is
+// scanned, the first 200 stargazers are overrepresented, so only the
+// random ones, which belong to a slice of the timeline, are returned.
+func timelineUsers(users []gql.User) []gql.User {
+	if uint(len(users)) <= 219 {
+		return users
+	}
+
+	var timeline []gql.User
+	for _, user := range users {
+		if user.Stratum != 0 {
+			timeline = append(timeline, user)
+		}
+	}
+
+	return timeline
+}
+
+// gatherTrustData gathers the values of each trust factor for the given stargazers.
+func gatherTrustData(users []gql.User) map[FactorName][]float64 {
 	trustData := make(map[FactorName][]float64)
 	now := time.Now().Year()
 
@@ -64,32 +162,83 @@ func Compute(ctx *context.Context, users []gql.User) (*Report, error) {
 		trustData[PRContributionFactor] = append(trustData[PRContributionFactor], float64(users[idx].Contributions.TotalPullRequestContributions))
 		trustData[PRReviewContributionFactor] = append(trustData[PRReviewContributionFactor], float64(users[idx].Contributions.TotalPullRequestReviewContributions))
 		trustData[AccountAgeFactor] = append(trustData[AccountAgeFactor], users[idx].DaysOld())
+		trustData[ProfileCompletenessFactor] = append(trustData[ProfileCompletenessFactor], profileCompleteness(users[idx]))
+		trustData[FollowerRatioFactor] = append(trustData[FollowerRatioFactor], followerRatio(users[idx]))
+		trustData[StarOnlyAccountFactor] = append(trustData[StarOnlyAccountFactor], starOnly(users[idx]))
 		trustData[ContributionScoreFactor] = append(trustData[ContributionScoreFactor], contributionScore)
 	}
 
-	disgo.StartStepf("Building trust report")
+	return trustData
+}
 
-	defer disgo.EndStep()
+// computeStrata computes the trust factors of the stargazers of each slice
+// of the stargazer timeline, so that suspicious slices stand out even when
+// the rest of the timeline hides them in the averages.
+func computeStrata(users []gql.User, refs references) ([]Stratum, error) {
+	strataUsers := make(map[int][]gql.User)
+	var indexes []int
+	for _, user := range users {
+		if user.Stratum == 0 {
+			continue
+		}
 
-	if uint(len(users)) > 219 {
-		return buildComparativeReport(trustData)
+		if _, ok := strataUsers[user.Stratum]; !ok {
+			indexes = append(indexes, user.Stratum)
+		}
+		strataUsers[user.Stratum] = append(strataUsers[user.Stratum], user)
+	}
+	sort.Ints(indexes)
+
+	var strata []Stratum
+	for _, index := range indexes {
+		report, err := buildReport(gatherTrustData(strataUsers[index]), nil, refs)
+		if err != nil {
+			return nil, err
+		}
+
+		strata = append(strata, Stratum{
+			Index:   index,
+			Users:   len(strataUsers[index]),
+			Factors: report.Factors,
+		})
 	}
 
-	return buildReport(trustData)
+	return strata, nil
 }
 
-func buildReport(trustData map[FactorName][]float64) (*Report, error) {
+// horizon returns the amount of years of contributions that were fetched
+// for the scan. Without a configured year, the longest horizon is assumed.
+func horizon(ctx *context.Context) int {
+	if ctx.SinceYear == 0 {
+		return math.MaxInt32
+	}
+
+	return time.Now().Year() - ctx.SinceYear + 1
+}
+
+// buildReport builds a report from the trust data of stargazers, and from
+// the factors which are computed for the whole repository. Trust levels
+// are computed using the given references.
+func buildReport(trustData map[FactorName][]float64, repoFactors map[FactorName]Factor, refs references) (*Report, error) {
 	report := &Report{
 		Factors: make(map[FactorName]Factor),
 	}
 
+	for factor, value := range repoFactors {
+		report.Factors[factor] = value
+	}
+
 	for factor, data := range trustData {
 		score, err := stats.Mean(data)
 		if err != nil {
 			return nil, disgo.FailStepf("unable to compute score for factor %q: %v", factor, err)
 		}
 
-		trustPercent := computeTrustFromScore(score, factorReferences[factor])
+		trustPercent := computeTrustFromScore(score, refs.factors[factor])
+		if inverseFactors[factor] {
+			trustPercent = computeTrustFromInverseScore(score, refs.factors[factor])
+		}
+
 		report.Factors[factor] = Factor{
 			Value:        score,
 			TrustPercent: trustPercent,
@@ -111,22 +260,19 @@ func buildReport(trustData map[FactorName][]float64) (*Report, error) {
 
 			report.Percentiles[percentile] = Factor{
 				Value:        value,
-				TrustPercent: computeTrustFromScore(value, percentileReferences[percentile]),
+				TrustPercent: computeTrustFromScore(value, refs.percentiles[percentile]),
 			}
 		}
 	}
 
-	var allTrust []float64
-	for factorName, weight := range factorWeights {
-		for i := 0; i < weight; i++ {
-			allTrust = append(allTrust, report.Factors[factorName].TrustPercent)
-		}
-	}
+	allTrust := weightedTrust(report)
 
 	// Take percentiles into consideration, if they were
 	// computed.
-	for _, percentileTrust := range report.Percentiles {
-		allTrust = append(allTrust, percentileTrust.TrustPercent)
+	if report.Percentiles != nil {
+		for _, percentile := range percentiles {
+			allTrust = append(allTrust, report.Percentiles[percentile].TrustPercent)
+		}
 	}
 
 	trust, err := stats.Mean(allTrust)
@@ -141,28 +287,33 @@ func buildReport(trustData map[FactorName][]float64) (*Report, error) {
 	return report, nil
 }
 
-// buildComparativeReport splits the trust data and percentiles between the first stargazers
-// and current stargazers, and it then builds a report that contains the worst of both sets.
-func buildComparativeReport(trustData map[FactorName][]float64) (*Report, error) {
+// buildComparativeReport splits the trust data and percentiles of the given users between
+// the first stargazers and current stargazers, and it then builds a report that contains
+// the worst of both sets.
+func buildComparativeReport(users []gql.User, trustData map[FactorName][]float64, repoFactors map[FactorName]Factor, refs references) (*Report, error) {
 	report := &Report{
 		Factors:     make(map[FactorName]Factor),
 		Percentiles: make(map[Percentile]Factor),
 	}
 
-	firstStarsTrust, currentStarsTrust := splitTrustData(trustData)
+	for factor, value := range repoFactors {
+		report.Factors[factor] = value
+	}
+
+	firstStarsTrust, currentStarsTrust := splitTrustData(users, trustData)
 
 	// Compute one trust report for the early stargazers.
-	firstStarsReport, err := buildReport(firstStarsTrust)
+	firstStarsReport, err := buildReport(firstStarsTrust, nil, refs)
 	if err != nil {
 		return nil, err
 	}
 
-	disgo.Debugln(style.Important("First 200 stargazers"))
+	disgo.Debugln(style.Important("First ", len(firstStarsTrust[ContributionScoreFactor]), " stargazers"))
 
 	Render(firstStarsReport, false)
 
 	// Compute another trust report for the random stargazers.
-	currentStarsReport, err := buildReport(currentStarsTrust)
+	currentStarsReport, err := buildReport(currentStarsTrust, nil, refs)
 	if err != nil {
 		return nil, err
 	}
@@ -194,12 +345,7 @@ func buildComparativeReport(trustData map[FactorName][]float64) (*Report, error)
 		}
 	}
 
-	var allTrust []float64
-	for factorName, weight := range factorWeights {
-		for i := 0; i < weight; i++ {
-			allTrust = append(allTrust, report.Factors[factorName].TrustPercent)
-		}
-	}
+	allTrust := weightedTrust(report)
 
 	for _, percentile := range percentiles {
 		// Skip percentiles if the random sample is too small to have percentiles.
@@ -221,20 +367,38 @@ func buildComparativeReport(trustData map[FactorName][]float64) (*Report, error)
 	return report, nil
 }
 
-// splitTrustData split a trust data map between first and random stargazers.
-func splitTrustData(trustData map[FactorName][]float64) (first, current map[FactorName][]float64) {
-	total := len(trustData[ContributionScoreFactor])
+// weightedTrust returns the trust levels of the factors of a report, each
+// repeated according to its weight. Factors are always taken in the same
+// order, so that the overall trust of identical scans is identical.
+func weightedTrust(report *Report) []float64 {
+	var allTrust []float64
+	for _, factorName := range append(append([]FactorName{}, factors...), repositoryFactors...) {
+		// Repository factors are not always computed.
+		if _, ok := report.Factors[factorName]; !ok {
+			continue
+		}
 
-	// Compute first stars.
+		for i := 0; i < factorWeights[factorName]; i++ {
+			allTrust = append(allTrust, report.Factors[factorName].TrustPercent)
+		}
+	}
+
+	return allTrust
+}
+
+// splitTrustData split a trust data map of the given users between first and random
+// stargazers. Random stargazers belong to a slice of the stargazer timeline, while the
+// first ones don't, so dropped users don't shift the split.
+func splitTrustData(users []gql.User, trustData map[FactorName][]float64) (first, current map[FactorName][]float64) {
 	first = make(map[FactorName][]float64)
 	current = make(map[FactorName][]float64)
 	for _, factor := range factors {
-		for i := 0; i < 200; i++ {
-			first[factor] = append(first[factor], trustData[factor][i])
-		}
-
-		for i := 200; i < total; i++ {
-			current[factor] = append(current[factor], trustData[factor][i])
+		for i, user := range users {
+			if user.Stratum == 0 {
+				first[factor] = append(first[factor], trustData[factor][i])
+			} else {
+				current[factor] = append(current[factor], trustData[factor][i])
+			}
 		}
 	}
 
@@ -253,3 +417,18 @@ func computeTrustFromScore(score, reference float64) float64 {
 
 	return trust
 }
+
+// computeTrustFromInverseScore computes a trust level for scores which
+// are more trustworthy when they are low. Trust is 0.99 for a score of
+// zero, and it reaches zero when the score is equal to the reference.
+func computeTrustFromInverseScore(score, reference float64) float64 {
+	trust := 1 - score/reference
+	if trust > 0.99 {
+		trust = 0.99
+	}
+	if trust < 0 {
+		trust = 0
+	}
+
+	return trust
+}
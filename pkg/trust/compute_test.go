@@ -1,8 +1,12 @@
 package trust
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/Ullaakut/astronomer/pkg/context"
+	"github.com/Ullaakut/astronomer/pkg/gql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,7 +34,29 @@ func TestBuildReport(t *testing.T) {
 		ContributionScoreFactor:    []float64{0, 2 * factorReferences[ContributionScoreFactor], 4 * factorReferences[ContributionScoreFactor]},
 	}
 
-	report, err := buildReport(trustData)
+	report, err := buildReport(trustData, nil, referencesFor(7))
+	require.NoError(t, err)
+	require.NotNil(t, report)
+
+	for factor, expectedTrust := range expectedFactors {
+		assert.Equal(t, expectedTrust, report.Factors[factor], "unexpected value for factor %q", factor)
+	}
+}
+
+func TestBuildReportWithProfileFactors(t *testing.T) {
+	expectedFactors := map[FactorName]Factor{
+		ProfileCompletenessFactor: Factor{Value: factorReferences[ProfileCompletenessFactor], TrustPercent: 1 / 1.5},
+		FollowerRatioFactor:       Factor{Value: 2 * factorReferences[FollowerRatioFactor], TrustPercent: 0.99},
+		StarOnlyAccountFactor:     Factor{Value: factorReferences[StarOnlyAccountFactor] / 2, TrustPercent: 0.5},
+	}
+
+	trustData := map[FactorName][]float64{
+		ProfileCompletenessFactor: []float64{0, factorReferences[ProfileCompletenessFactor], 2 * factorReferences[ProfileCompletenessFactor]},
+		FollowerRatioFactor:       []float64{0, 2 * factorReferences[FollowerRatioFactor], 4 * factorReferences[FollowerRatioFactor]},
+		StarOnlyAccountFactor:     []float64{0, factorReferences[StarOnlyAccountFactor] / 2, factorReferences[StarOnlyAccountFactor]},
+	}
+
+	report, err := buildReport(trustData, nil, referencesFor(7))
 	require.NoError(t, err)
 	require.NotNil(t, report)
 
@@ -84,7 +110,7 @@ func TestBuildReportWithPercentiles(t *testing.T) {
 		ContributionScoreFactor:    []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
 	}
 
-	report, err := buildReport(trustData)
+	report, err := buildReport(trustData, nil, referencesFor(7))
 	require.NoError(t, err)
 	require.NotNil(t, report)
 
@@ -103,15 +129,23 @@ func TestSplitTrustReports(t *testing.T) {
 	earlyUser := float64(1)
 	randomUser := float64(2)
 
-	trustData = addToTrustData(trustData, 200, earlyUser)
+	// Some of the first stargazers were dropped from the scan.
+	trustData = addToTrustData(trustData, 190, earlyUser)
 	trustData = addToTrustData(trustData, 800, randomUser)
 
-	earlyUsers, randomUsers := splitTrustData(trustData)
+	users := make([]gql.User, 990)
+	for idx := range users {
+		if idx >= 190 {
+			users[idx].Stratum = 1 + idx%5
+		}
+	}
+
+	earlyUsers, randomUsers := splitTrustData(users, trustData)
 	require.NotNil(t, earlyUsers)
 	require.NotNil(t, randomUsers)
 
 	for _, data := range earlyUsers {
-		assert.Len(t, data, 200)
+		assert.Len(t, data, 190)
 		for _, userValue := range data {
 			assert.Equal(t, userValue, earlyUser)
 		}
@@ -134,3 +168,149 @@ func addToTrustData(trustData map[FactorName][]float64, amount int, value float6
 
 	return trustData
 }
+
+func TestBuildReportWithRepositoryFactors(t *testing.T) {
+	trustData := make(map[FactorName][]float64)
+	trustData = addToTrustData(trustData, 3, 0)
+
+	withoutBursts, err := buildReport(trustData, nil, referencesFor(7))
+	require.NoError(t, err)
+
+	repoFactors := map[FactorName]Factor{
+		StarBurstFactor: Factor{Value: 0, TrustPercent: 0.99},
+	}
+
+	withBursts, err := buildReport(trustData, repoFactors, referencesFor(7))
+	require.NoError(t, err)
+
+	assert.Equal(t, repoFactors[StarBurstFactor], withBursts.Factors[StarBurstFactor])
+	assert.True(t, withBursts.Factors[Overall].TrustPercent > withoutBursts.Factors[Overall].TrustPercent)
+}
+
+func TestReferencesFor(t *testing.T) {
+	tests := map[string]struct {
+		horizon int
+
+		expectedReferences references
+	}{
+		"shorter than every table": {
+			horizon:            0,
+			expectedReferences: referenceTables[1],
+		},
+		"exact horizon": {
+			horizon:            3,
+			expectedReferences: referenceTables[3],
+		},
+		"between two tables": {
+			horizon:            4,
+			expectedReferences: referenceTables[3],
+		},
+		"longer than every table": {
+			horizon:            14,
+			expectedReferences: referenceTables[7],
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedReferences, referencesFor(test.horizon))
+		})
+	}
+}
+
+func TestReferencesScale(t *testing.T) {
+	// A shorter horizon must never expect more contributions than a longer one.
+	var previous references
+	for _, horizon := range []int{1, 2, 3, 5, 7} {
+		refs := referenceTables[horizon]
+		for _, factor := range factors {
+			require.Contains(t, refs.factors, factor)
+			assert.True(t, refs.factors[factor] > 0)
+			if previous.factors != nil {
+				assert.True(t, refs.factors[factor] >= previous.factors[factor], "factor %q for horizon %d", factor, horizon)
+			}
+		}
+
+		for _, percentile := range percentiles {
+			require.Contains(t, refs.percentiles, percentile)
+			assert.True(t, refs.percentiles[percentile] > 0)
+			if previous.percentiles != nil {
+				assert.True(t, refs.percentiles[percentile] >= previous.percentiles[percentile], "percentile %q for horizon %d", percentile, horizon)
+			}
+		}
+
+		previous = refs
+	}
+}
+
+func TestComputeUsesHorizonReferences(t *testing.T) {
+	users := make([]gql.User, 10)
+	for idx := range users {
+		users[idx].CreatedAt = "2015-01-01T00:00:00Z"
+		users[idx].Contributions.TotalCommitContributions = 100
+		users[idx].YearlyContributions = map[int]int{time.Now().Year(): 100}
+	}
+
+	full, err := Compute(&context.Context{SinceYear: 2013, Seed: 42, Population: 1000}, users)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), full.Seed)
+	assert.Equal(t, uint(1000), full.Population)
+
+	recent, err := Compute(&context.Context{SinceYear: time.Now().Year()}, users)
+	require.NoError(t, err)
+
+	// The same commits are more trustworthy when only one year was fetched.
+	assert.InDelta(t, computeTrustFromScore(100, factorReferences[CommitContributionFactor]), full.Factors[CommitContributionFactor].TrustPercent, 0.001)
+	assert.InDelta(t, computeTrustFromScore(100, referenceTables[1].factors[CommitContributionFactor]), recent.Factors[CommitContributionFactor].TrustPercent, 0.001)
+	assert.True(t, recent.Factors[CommitContributionFactor].TrustPercent > full.Factors[CommitContributionFactor].TrustPercent)
+}
+
+func TestTimelineUsers(t *testing.T) {
+	// Some of the first stargazers were dropped from the scan.
+	users := make([]gql.User, 230)
+	for idx := range users {
+		users[idx].Login = fmt.Sprintf("u%d", idx)
+		if idx >= 190 {
+			users[idx].Stratum = 1 + idx%2
+		}
+	}
+
+	timeline := timelineUsers(users)
+	require.Len(t, timeline, 40)
+	assert.Equal(t, users[190:], timeline)
+
+	// Small samples contain every stargazer.
+	assert.Equal(t, users[:150], timelineUsers(users[:150]))
+}
+
+func TestComputeStrata(t *testing.T) {
+	users := make([]gql.User, 60)
+	for idx := range users {
+		users[idx].CreatedAt = "2015-01-01T00:00:00Z"
+		users[idx].YearlyContributions = map[int]int{time.Now().Year(): 100}
+
+		// The first stargazers are not part of any stratum, and the
+		// stargazers of the second stratum never contributed.
+		switch {
+		case idx < 20:
+		case idx < 40:
+			users[idx].Stratum = 2
+			users[idx].YearlyContributions = nil
+		default:
+			users[idx].Stratum = 1
+		}
+	}
+
+	strata, err := computeStrata(users, referencesFor(7))
+	require.NoError(t, err)
+	require.Len(t, strata, 2)
+
+	assert.Equal(t, 1, strata[0].Index)
+	assert.Equal(t, 20, strata[0].Users)
+	assert.Equal(t, float64(100), strata[0].Factors[ContributionScoreFactor].Value)
+
+	assert.Equal(t, 2, strata[1].Index)
+	assert.Equal(t, 20, strata[1].Users)
+	assert.Zero(t, strata[1].Factors[ContributionScoreFactor].Value)
+	assert.True(t, strata[1].Factors[Overall].TrustPercent < strata[0].Factors[Overall].TrustPercent)
+}
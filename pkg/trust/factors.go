@@ -11,11 +11,13 @@ const (
 	PRContributionFactor       FactorName = "Pull requests"
 	PRReviewContributionFactor FactorName = "Code reviews"
 	AccountAgeFactor           FactorName = "Account age (days)"
+	ProfileCompletenessFactor  FactorName = "Profile completeness (%)"
+	FollowerRatioFactor        FactorName = "Followers ratio (%)"
+	StarOnlyAccountFactor      FactorName = "Star-only accounts (%)"
+	StarBurstFactor            FactorName = "Stars in bursts (%)"
 	Overall                    FactorName = "Overall trust"
 )
 
-// TODO: If we allow users to choose the year until which
-// to scan, references will be needed for each year.
 var (
 	factors = []FactorName{
 		ContributionScoreFactor,
@@ -26,12 +28,27 @@ var (
 		PRContributionFactor,
 		PRReviewContributionFactor,
 		AccountAgeFactor,
+		ProfileCompletenessFactor,
+		FollowerRatioFactor,
+		StarOnlyAccountFactor,
+	}
+
+	// inverseFactors are more trustworthy when their value is low.
+	inverseFactors = map[FactorName]bool{
+		StarOnlyAccountFactor: true,
+	}
+
+	// repositoryFactors are computed from the repository's
+	// timeline instead of from each stargazer's data.
+	repositoryFactors = []FactorName{
+		StarBurstFactor,
 	}
 
 	percentiles = []Percentile{"5", "10", "15", "20", "25", "30", "35", "40", "45", "50", "55", "60", "65", "70", "75", "80", "85", "90", "95"}
 
 	// References are based on the average values of values typically
-	// found on popular repositories.
+	// found on popular repositories, for contributions fetched over
+	// seven years or more.
 	factorReferences = map[FactorName]float64{
 		PrivateContributionFactor:  300,
 		ContributionScoreFactor:    18000,
@@ -41,6 +58,17 @@ var (
 		PRContributionFactor:       20,
 		PRReviewContributionFactor: 7,
 		AccountAgeFactor:           1600,
+		ProfileCompletenessFactor:  40,
+		FollowerRatioFactor:        35,
+
+		// The star-only account factor is the percentage of stargazers
+		// who star many repositories without owning any, so lower values
+		// are more trustworthy.
+		StarOnlyAccountFactor: 25,
+
+		// The star burst factor is the percentage of stars received
+		// during bursts, so lower values are more trustworthy.
+		StarBurstFactor: 30,
 	}
 
 	percentileReferences = map[Percentile]float64{
@@ -65,6 +93,163 @@ var (
 		"95": 51230,
 	}
 
+	// referenceTables contain the references to use according to the
+	// horizon of a scan, which is the amount of years of contributions
+	// that were fetched. References of shorter horizons are derived from
+	// the seven years references, assuming that contributions are spread
+	// evenly over the years. Factors that do not depend on contributions
+	// have the same references regardless of the horizon.
+	referenceTables = map[int]references{
+		1: {
+			factors: map[FactorName]float64{
+				PrivateContributionFactor:  43,
+				ContributionScoreFactor:    129,
+				IssueContributionFactor:    2.6,
+				CommitContributionFactor:   53,
+				RepoContributionFactor:     3.6,
+				PRContributionFactor:       2.9,
+				PRReviewContributionFactor: 1,
+				AccountAgeFactor:           1600,
+				ProfileCompletenessFactor:  40,
+				FollowerRatioFactor:        35,
+				StarOnlyAccountFactor:      25,
+			},
+			percentiles: map[Percentile]float64{
+				"5":  0.043,
+				"10": 0.13,
+				"15": 0.24,
+				"20": 0.54,
+				"25": 1,
+				"30": 1.7,
+				"35": 2.8,
+				"40": 3.1,
+				"45": 4.5,
+				"50": 7.2,
+				"55": 11,
+				"60": 16,
+				"65": 26,
+				"70": 36,
+				"75": 56,
+				"80": 66,
+				"85": 127,
+				"90": 204,
+				"95": 366,
+			},
+		},
+		2: {
+			factors: map[FactorName]float64{
+				PrivateContributionFactor:  86,
+				ContributionScoreFactor:    643,
+				IssueContributionFactor:    5.1,
+				CommitContributionFactor:   106,
+				RepoContributionFactor:     7.1,
+				PRContributionFactor:       5.7,
+				PRReviewContributionFactor: 2,
+				AccountAgeFactor:           1600,
+				ProfileCompletenessFactor:  40,
+				FollowerRatioFactor:        35,
+				StarOnlyAccountFactor:      25,
+			},
+			percentiles: map[Percentile]float64{
+				"5":  0.21,
+				"10": 0.64,
+				"15": 1.2,
+				"20": 2.7,
+				"25": 5.1,
+				"30": 8.3,
+				"35": 14,
+				"40": 16,
+				"45": 22,
+				"50": 36,
+				"55": 53,
+				"60": 80,
+				"65": 131,
+				"70": 182,
+				"75": 280,
+				"80": 330,
+				"85": 636,
+				"90": 1018,
+				"95": 1830,
+			},
+		},
+		3: {
+			factors: map[FactorName]float64{
+				PrivateContributionFactor:  129,
+				ContributionScoreFactor:    1800,
+				IssueContributionFactor:    7.7,
+				CommitContributionFactor:   159,
+				RepoContributionFactor:     11,
+				PRContributionFactor:       8.6,
+				PRReviewContributionFactor: 3,
+				AccountAgeFactor:           1600,
+				ProfileCompletenessFactor:  40,
+				FollowerRatioFactor:        35,
+				StarOnlyAccountFactor:      25,
+			},
+			percentiles: map[Percentile]float64{
+				"5":  0.6,
+				"10": 1.8,
+				"15": 3.4,
+				"20": 7.6,
+				"25": 14,
+				"30": 23,
+				"35": 40,
+				"40": 44,
+				"45": 62,
+				"50": 100,
+				"55": 149,
+				"60": 223,
+				"65": 368,
+				"70": 510,
+				"75": 785,
+				"80": 923,
+				"85": 1780,
+				"90": 2850,
+				"95": 5123,
+			},
+		},
+		5: {
+			factors: map[FactorName]float64{
+				PrivateContributionFactor:  214,
+				ContributionScoreFactor:    7071,
+				IssueContributionFactor:    13,
+				CommitContributionFactor:   264,
+				RepoContributionFactor:     18,
+				PRContributionFactor:       14,
+				PRReviewContributionFactor: 5,
+				AccountAgeFactor:           1600,
+				ProfileCompletenessFactor:  40,
+				FollowerRatioFactor:        35,
+				StarOnlyAccountFactor:      25,
+			},
+			percentiles: map[Percentile]float64{
+				"5":  2.4,
+				"10": 7.1,
+				"15": 13,
+				"20": 30,
+				"25": 56,
+				"30": 91,
+				"35": 156,
+				"40": 171,
+				"45": 246,
+				"50": 395,
+				"55": 585,
+				"60": 876,
+				"65": 1446,
+				"70": 2004,
+				"75": 3084,
+				"80": 3626,
+				"85": 6993,
+				"90": 11194,
+				"95": 20126,
+			},
+		},
+		7: {
+			factors:     factorReferences,
+			percentiles: percentileReferences,
+		},
+	}
+
 	// factorWeights represents the importance of each factor in
 	// the calculation of the overall trust factor.
 	factorWeights = map[FactorName]int{
@@ -76,5 +261,35 @@ var (
 		PRReviewContributionFactor: 2,
 		ContributionScoreFactor:    8,
 		AccountAgeFactor:           2,
+		ProfileCompletenessFactor:  2,
+		FollowerRatioFactor:        1,
+		StarOnlyAccountFactor:      2,
+		StarBurstFactor:            3,
 	}
 )
+
+// references are the expected values of trust factors and percentiles
+// for legitimate stargazers.
+type references struct {
+	factors     map[FactorName]float64
+	percentiles map[Percentile]float64
+}
+
+// referencesFor returns the references that match the given horizon, which
+// is the amount of years of contributions that were fetched. The table of
+// the longest horizon that does not exceed it is used.
+func referencesFor(horizon int) references {
+	best := 0
+	for tableHorizon := range referenceTables {
+		if tableHorizon <= horizon && tableHorizon > best {
+			best = tableHorizon
+		}
+	}
+
+	// Shorter horizons than the shortest table use the shortest table.
+	if best == 0 {
+		best = 1
+	}
+
+	return referenceTables[best]
+}
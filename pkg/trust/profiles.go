@@ -0,0 +1,51 @@
+package trust
+
+import "github.com/Ullaakut/astronomer/pkg/gql"
+
+// Accounts that starred at least this many repositories without owning
+// any are considered to exist only to star repositories.
+const starOnlyMinimumStars = 50
+
+// profileCompleteness returns the percentage of the profile of a user that
+// was filled in: their bio, company, location, website and avatar.
+func profileCompleteness(user gql.User) float64 {
+	fields := []bool{
+		user.Bio != "",
+		user.Company != "",
+		user.Location != "",
+		user.WebsiteURL != "",
+		!user.HasDefaultAvatar,
+	}
+
+	var filled int
+	for _, isFilled := range fields {
+		if isFilled {
+			filled++
+		}
+	}
+
+	return 100 * float64(filled) / float64(len(fields))
+}
+
+// followerRatio returns the percentage of followers in the social graph of
+// a user. Bot accounts often follow many users, but are followed by none.
+// Users who neither follow nor are followed by anyone have a ratio of zero.
+func followerRatio(user gql.User) float64 {
+	total := user.Followers.TotalCount + user.Following.TotalCount
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(user.Followers.TotalCount) / float64(total)
+}
+
+// starOnly returns 100 if the user starred many repositories without owning
+// any, and 0 otherwise, so that its average is the percentage of such
+// accounts among stargazers.
+func starOnly(user gql.User) float64 {
+	if user.Repositories.TotalCount == 0 && user.StarredRepositories.TotalCount >= starOnlyMinimumStars {
+		return 100
+	}
+
+	return 0
+}
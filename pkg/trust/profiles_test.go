@@ -0,0 +1,70 @@
+package trust
+
+import (
+	"testing"
+
+	"github.com/Ullaakut/astronomer/pkg/gql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileFactors(t *testing.T) {
+	complete := gql.User{
+		Bio:        "Gopher",
+		Company:    "Astronomer",
+		Location:   "Paris",
+		WebsiteURL: "https://ullaakut.eu",
+	}
+	complete.Followers.TotalCount = 30
+	complete.Following.TotalCount = 10
+	complete.Repositories.TotalCount = 12
+	complete.StarredRepositories.TotalCount = 400
+
+	starOnlyBot := gql.User{
+		HasDefaultAvatar: true,
+	}
+	starOnlyBot.Following.TotalCount = 150
+	starOnlyBot.StarredRepositories.TotalCount = 800
+
+	lurker := gql.User{
+		Location: "Berlin",
+	}
+	lurker.StarredRepositories.TotalCount = 3
+
+	tests := map[string]struct {
+		user gql.User
+
+		expectedCompleteness float64
+		expectedRatio        float64
+		expectedStarOnly     float64
+	}{
+		"complete profile": {
+			user: complete,
+
+			expectedCompleteness: 100,
+			expectedRatio:        75,
+			expectedStarOnly:     0,
+		},
+		"star-only bot": {
+			user: starOnlyBot,
+
+			expectedCompleteness: 0,
+			expectedRatio:        0,
+			expectedStarOnly:     100,
+		},
+		"user without social graph": {
+			user: lurker,
+
+			expectedCompleteness: 40,
+			expectedRatio:        0,
+			expectedStarOnly:     0,
+		},
+	}
+
+	for description, test := range tests {
+		t.Run(description, func(t *testing.T) {
+			assert.Equal(t, test.expectedCompleteness, profileCompleteness(test.user))
+			assert.Equal(t, test.expectedRatio, followerRatio(test.user))
+			assert.Equal(t, test.expectedStarOnly, starOnly(test.user))
+		})
+	}
+}
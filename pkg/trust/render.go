@@ -2,6 +2,7 @@ package trust
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/Ullaakut/disgo"
@@ -43,19 +44,118 @@ func Render(report *Report, info bool) {
 		return
 	}
 
+	if report.Partial {
+		printf(info, "\n%s\n", style.Failure("PARTIAL REPORT: the scan was interrupted, so this report is computed from only part of the sampled stargazers"))
+	}
+
 	printHeader(info)
 
 	for _, factorName := range factors {
 		printFactor(info, string(factorName), report.Factors[factorName])
 	}
 
+	for _, factorName := range repositoryFactors {
+		if factor, ok := report.Factors[factorName]; ok {
+			printFactor(info, string(factorName), factor)
+		}
+	}
+
 	if report.Percentiles != nil {
 		for _, percentile := range percentiles {
 			printPercentile(info, percentile, report.Percentiles[percentile])
 		}
 	}
 
+	printStrata(info, report.Strata)
+
+	printStarBursts(info, report.StarBursts)
+
+	printDropped(info, report.Dropped)
+
 	printResult(info, "Overall trust", report.Factors[Overall])
+
+	printSeed(info, report.Seed, report.Population)
+}
+
+// printSeed prints the seed with which stargazers were selected, and the
+// amount of stargazers among which they were, so that the report can be
+// reproduced once the repository received new stars.
+func printSeed(info bool, seed int64, population uint) {
+	if seed == 0 {
+		return
+	}
+
+	if population == 0 {
+		printf(info, "\nStargazers were sampled with seed %d. Scan again with --seed %d to reproduce this report.\n", seed, seed)
+		return
+	}
+
+	printf(info, "\nStargazers were sampled with seed %d among the first %d stargazers. Scan again with --seed %d --population %d to reproduce this report.\n", seed, population, seed, population)
+}
+
+// printStrata prints the weighted contributions and the overall trust of
+// the random stargazers of each slice of the stargazer timeline, in the
+// following format:
+// Slice 2/5 (160 stargazers):          12778            B
+func printStrata(info bool, strata []Stratum) {
+	if len(strata) == 0 {
+		return
+	}
+
+	printf(info, "\n%s\n", style.Important("Trust by slice of the stargazer timeline"))
+
+	total := strata[len(strata)-1].Index
+	for _, stratum := range strata {
+		printFactor(info, fmt.Sprintf("Slice %d/%d (%d stargazers)", stratum.Index, total, stratum.Users), Factor{
+			Value:        stratum.Factors[ContributionScoreFactor].Value,
+			TrustPercent: stratum.Factors[Overall].TrustPercent,
+		})
+	}
+}
+
+// printStarBursts prints the windows during which the repository received
+// a suspicious amount of stars, in the following format:
+// 2019-05-06 to 2019-05-12:            42                sampled stars
+func printStarBursts(info bool, bursts []StarBurst) {
+	if len(bursts) == 0 {
+		return
+	}
+
+	printf(info, "\n%s\n", style.Important("Suspicious star bursts"))
+
+	for _, burst := range bursts {
+		window := fmt.Sprintf("%s to %s", burst.Start.Format("2006-01-02"), burst.End.Format("2006-01-02"))
+		format := tabulateFormat(factorsFormat, window, firstColumnLength)
+		format = tabulateFormat(format, fmt.Sprint(burst.Stars), secondColumnLength+2)
+
+		printf(info, format, window, style.Failure(burst.Stars), "sampled stars")
+	}
+}
+
+// printDropped prints the amount of sampled stargazers that were left out of
+// the report for each reason, in the following format:
+// not found:                           3                 stargazers
+func printDropped(info bool, dropped map[string]int) {
+	if len(dropped) == 0 {
+		return
+	}
+
+	var total int
+	var reasons []string
+	for reason, count := range dropped {
+		total += count
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	printf(info, "\n%s\n", style.Important(fmt.Sprintf("%d sampled stargazers were dropped because their data could not be fetched", total)))
+
+	for _, reason := range reasons {
+		format := tabulateFormat(factorsFormat, reason, firstColumnLength)
+		format = tabulateFormat(format, fmt.Sprint(dropped[reason]), secondColumnLength+2)
+
+		printf(info, format, reason, style.Failure(dropped[reason]), "stargazers")
+	}
 }
 
 // printHeader prints the header containing each category name and underlines them.
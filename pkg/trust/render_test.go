@@ -3,6 +3,7 @@ package trust
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/Ullaakut/disgo"
@@ -53,3 +54,82 @@ func TestPrintHeader(t *testing.T) {
 	assert.Contains(t, logger.String(), "Averages                             Score           Trust")
 	assert.Contains(t, logger.String(), "--------                             -----           -----")
 }
+
+func TestPrintStarBursts(t *testing.T) {
+	logger := &bytes.Buffer{}
+	disgo.SetTerminalOptions(disgo.WithColors(false), disgo.WithDefaultOutput(logger), disgo.WithErrorOutput(logger))
+
+	printStarBursts(true, []StarBurst{
+		{
+			Start: time.Date(2019, time.May, 6, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2019, time.May, 12, 0, 0, 0, 0, time.UTC),
+			Stars: 42,
+		},
+	})
+
+	assert.Contains(t, logger.String(), "Suspicious star bursts")
+	assert.Contains(t, logger.String(), "2019-05-06 to 2019-05-12:            42                sampled stars")
+}
+
+func TestPrintDropped(t *testing.T) {
+	logger := &bytes.Buffer{}
+	disgo.SetTerminalOptions(disgo.WithColors(false), disgo.WithDefaultOutput(logger), disgo.WithErrorOutput(logger))
+
+	printDropped(true, nil)
+	assert.Empty(t, logger.String())
+
+	printDropped(true, map[string]int{
+		"not found":                     3,
+		"contributions kept timing out": 2,
+	})
+
+	assert.Contains(t, logger.String(), "5 sampled stargazers were dropped because their data could not be fetched")
+	assert.Contains(t, logger.String(), "not found:                           3                 stargazers")
+	assert.Contains(t, logger.String(), "contributions kept timing out:       2                 stargazers")
+}
+
+func TestPrintSeed(t *testing.T) {
+	logger := &bytes.Buffer{}
+	disgo.SetTerminalOptions(disgo.WithColors(false), disgo.WithDefaultOutput(logger), disgo.WithErrorOutput(logger))
+
+	printSeed(true, 0, 1000)
+	assert.Empty(t, logger.String())
+
+	printSeed(true, 42, 0)
+	assert.Contains(t, logger.String(), "--seed 42 to")
+
+	printSeed(true, 42, 1000)
+	assert.Contains(t, logger.String(), "among the first 1000 stargazers")
+	assert.Contains(t, logger.String(), "--seed 42 --population 1000")
+}
+
+func TestPrintStrata(t *testing.T) {
+	logger := &bytes.Buffer{}
+	disgo.SetTerminalOptions(disgo.WithColors(false), disgo.WithDefaultOutput(logger), disgo.WithErrorOutput(logger))
+
+	printStrata(true, nil)
+	assert.Empty(t, logger.String())
+
+	printStrata(true, []Stratum{
+		{
+			Index: 1,
+			Users: 160,
+			Factors: map[FactorName]Factor{
+				ContributionScoreFactor: {Value: 12778},
+				Overall:                 {TrustPercent: 0.99},
+			},
+		},
+		{
+			Index: 2,
+			Users: 140,
+			Factors: map[FactorName]Factor{
+				ContributionScoreFactor: {Value: 42},
+				Overall:                 {TrustPercent: 0.1},
+			},
+		},
+	})
+
+	assert.Contains(t, logger.String(), "Trust by slice of the stargazer timeline")
+	assert.Contains(t, logger.String(), "Slice 1/2 (160 stargazers):          12778             A")
+	assert.Contains(t, logger.String(), "Slice 2/2 (140 stargazers):          42                E")
+}